@@ -3,7 +3,7 @@ module github.com/mannemsolutions/pgfga
 go 1.16
 
 require (
-	github.com/go-ldap/ldap/v3 v3.3.0
+	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/jackc/pgx/v4 v4.18.2
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/pg"
+	"text/template"
+)
+
+/*
+ * This module handles comments and security labels for users and roles, including the templated comments for the
+ * users created for the members of a *-group.
+ */
+
+// memberCommentData holds the fields that can be used in a member_comment template (e.a. {{.Group}})
+type memberCommentData struct {
+	User   string
+	Group  string
+	Role   string
+	Source string
+}
+
+func (mcd memberCommentData) render(commentTemplate string) (comment string, err error) {
+	tmpl, err := template.New("member_comment").Option("missingkey=error").Parse(commentTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid member_comment %s: %v", commentTemplate, err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, mcd)
+	if err != nil {
+		return "", fmt.Errorf("invalid member_comment %s: %v", commentTemplate, err)
+	}
+	return buf.String(), nil
+}
+
+// checkMemberComments checks that all member_comment templates are valid
+func (pfh PgFgaHandler) checkMemberComments() (err error) {
+	for userName, userConfig := range pfh.config.UserConfig {
+		if userConfig.MemberComment == "" {
+			continue
+		}
+		_, err = memberCommentData{}.render(userConfig.MemberComment)
+		if err != nil {
+			return fmt.Errorf("user %s has an %v", userName, err)
+		}
+	}
+	return nil
+}
+
+// setRoleMetadata sets the comment and security labels for a role
+func (pfh PgFgaHandler) setRoleMetadata(roleName string, state pg.State, metadata pg.Metadata) (err error) {
+	if !state.Bool() {
+		return nil
+	}
+	role, err := pfh.pg.GetRole(roleName)
+	if err != nil {
+		return err
+	}
+	return role.SetMetadata(metadata)
+}
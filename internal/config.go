@@ -3,11 +3,15 @@ package internal
 import (
 	"flag"
 	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+	"github.com/mannemsolutions/pgfga/pkg/identity"
 	"github.com/mannemsolutions/pgfga/pkg/ldap"
 	"github.com/mannemsolutions/pgfga/pkg/pg"
 	"go.uber.org/zap/zapcore"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -26,42 +30,136 @@ type FgaGeneralConfig struct {
 	LogLevel zapcore.Level `yaml:"loglevel"`
 	RunDelay time.Duration `yaml:"run_delay"`
 	Debug    bool          `yaml:"debug"`
+	// DryRun is set with the -n commandline argument, and stops after the plan (nothing is changed in postgres)
+	DryRun bool `yaml:"-"`
+}
+
+// Duration is a time.Duration which can (additionally) be set in days (e.a. 90d)
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var nanoseconds int64
+	if err := unmarshal(&nanoseconds); err == nil {
+		// Like time.Duration, an integer is in nanoseconds
+		*d = Duration(nanoseconds)
+		return nil
+	}
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return fmt.Errorf("invalid duration %s: %v", value, err)
+		}
+		*d = Duration(time.Duration(days) * 24 * time.Hour)
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
 }
 
 type FgaUserConfig struct {
-	Auth     string    `yaml:"auth"`
-	BaseDN   string    `yaml:"ldapbasedn"`
-	Filter   string    `yaml:"ldapfilter"`
-	MemberOf []string  `yaml:"memberof"`
-	Options  []string  `yaml:"options"`
-	Expiry   time.Time `yaml:"expiry"`
-	Password string    `yaml:"password"`
-	State    pg.State  `yaml:"state"`
+	Auth     string                `yaml:"auth"`
+	BaseDN   string                `yaml:"ldapbasedn"`
+	Filter   string                `yaml:"ldapfilter"`
+	Group    string                `yaml:"group"`
+	MemberOf []pg.Membership       `yaml:"memberof"`
+	Options  []string              `yaml:"options"`
+	Expiry   time.Time             `yaml:"expiry"`
+	Password credential.Credential `yaml:"password"`
+	State    pg.State              `yaml:"state"`
+	// Templates are the templates (from the templates section) this user was resolved from
+	Templates []string `yaml:"-"`
+	// Password* settings apply to generated passwords (password: generate)
+	PasswordSink     credential.Sink `yaml:"password_sink"`
+	PasswordRotation Duration        `yaml:"password_rotation"`
+	PasswordLength   int             `yaml:"password_length"`
+	PasswordGrace    Duration        `yaml:"password_grace"`
+	DualRoles        bool            `yaml:"dual_roles"`
+	ExpiresIn        Duration        `yaml:"expires_in"`
+	// Settings are configuration parameters for the user (ALTER ROLE ... SET), InDatabase holds them per database
+	Settings   map[string]string            `yaml:"settings"`
+	InDatabase map[string]map[string]string `yaml:"in_database"`
+	// Metadata holds the comment and security labels
+	pg.Metadata `yaml:",inline"`
+	// Member* settings apply to the users created for the members of an ldap-group
+	MemberOptions         []string        `yaml:"member_options"`
+	MemberMemberOf        []pg.Membership `yaml:"member_memberof"`
+	MemberExpiry          time.Time       `yaml:"member_expiry"`
+	MemberConnectionLimit *int            `yaml:"member_connection_limit"`
+	MirrorGroups          bool            `yaml:"mirror_groups"`
+	// MemberComment is a template for the comment of the users created for the members of a *-group
+	MemberComment string `yaml:"member_comment"`
 }
 
 type FgaRoleConfig struct {
-	Options  []string `yaml:"options"`
-	MemberOf []string `yaml:"member"`
-	State    pg.State `yaml:"state"`
+	Options     []string                     `yaml:"options"`
+	MemberOf    []pg.Membership              `yaml:"memberof"`
+	State       pg.State                     `yaml:"state"`
+	Templates   []string                     `yaml:"-"`
+	Settings    map[string]string            `yaml:"settings"`
+	InDatabase  map[string]map[string]string `yaml:"in_database"`
+	pg.Metadata `yaml:",inline"`
 }
 
 type FgaConfig struct {
-	GeneralConfig FgaGeneralConfig         `yaml:"general"`
-	StrictConfig  pg.StrictOptions         `yaml:"strict"`
-	LdapConfig    ldap.Config              `yaml:"ldap"`
-	PgDsn         pg.Dsn                   `yaml:"postgresql_dsn"`
-	DbsConfig     pg.Databases             `yaml:"databases"`
-	UserConfig    map[string]FgaUserConfig `yaml:"users"`
-	Roles         map[string]FgaRoleConfig `yaml:"roles"`
-	Slots         []string                 `yaml:"replication_slots"`
+	GeneralConfig  FgaGeneralConfig          `yaml:"general"`
+	StrictConfig   pg.StrictOptions          `yaml:"strict"`
+	SafetyConfig   FgaSafetyConfig           `yaml:"safety"`
+	PasswordPolicy credential.PasswordPolicy `yaml:"password_policy"`
+	ExpiryConfig   FgaExpiryConfig           `yaml:"expiry"`
+	LdapConfig     ldap.Config               `yaml:"ldap"`
+	FileGroups     identity.FileConfig       `yaml:"file_groups"`
+	UnixGroups     identity.UnixConfig       `yaml:"unix_groups"`
+	HttpGroups     identity.HttpConfig       `yaml:"http_groups"`
+	ScimGroups     identity.ScimConfig       `yaml:"scim_groups"`
+	PgDsn          pg.DsnConfig              `yaml:"postgresql_dsn"`
+	DbsConfig      pg.Databases              `yaml:"databases"`
+	UserConfig     map[string]FgaUserConfig  `yaml:"users"`
+	Roles          map[string]FgaRoleConfig  `yaml:"roles"`
+	Slots          []string                  `yaml:"replication_slots"`
+	// resolved holds the users and roles that reference templates (by section and name), as resolved from the templates
+	resolved map[string]map[string]yamlMap
+}
+
+// UnmarshalYAML reads the memberships of a role from memberof (like for users), or from member (which is an alias)
+func (rc *FgaRoleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain FgaRoleConfig
+	if err := unmarshal((*plain)(rc)); err != nil {
+		return err
+	}
+	var alias struct {
+		Member []pg.Membership `yaml:"member"`
+	}
+	if err := unmarshal(&alias); err != nil {
+		return err
+	}
+	if len(alias.Member) == 0 {
+		return nil
+	}
+	if len(rc.MemberOf) > 0 {
+		return fmt.Errorf("memberof and member (which is an alias) cannot both be set for a role")
+	}
+	rc.MemberOf = alias.Member
+	return nil
 }
 
 func NewConfig() (config FgaConfig, err error) {
 	var configFile string
 	var debug bool
 	var version bool
+	var force bool
+	var dryRun bool
 	flag.BoolVar(&debug, "d", false, "Add debugging output")
 	flag.BoolVar(&version, "v", false, "Show version information")
+	flag.BoolVar(&force, "f", false, "Force changes that exceed the safety thresholds")
+	flag.BoolVar(&dryRun, "n", false, "Dry run: validate the config and resolve all groups, without changing anything")
 	flag.StringVar(&configFile, "c", os.Getenv(envConfName), "Path to configfile")
 
 	flag.Parse()
@@ -83,7 +181,29 @@ func NewConfig() (config FgaConfig, err error) {
 	if err != nil {
 		return config, err
 	}
-	err = yaml.Unmarshal(yamlConfig, &config)
+	config, err = parseConfig(yamlConfig)
+	if err != nil {
+		return config, err
+	}
 	config.GeneralConfig.Debug = config.GeneralConfig.Debug || debug
+	config.SafetyConfig.Override = force
+	config.GeneralConfig.DryRun = dryRun
 	return config, err
 }
+
+// parseConfig returns the config from the yaml config, with all templates resolved
+func parseConfig(yamlConfig []byte) (config FgaConfig, err error) {
+	resolved, err := resolveTemplates(yamlConfig)
+	if err != nil {
+		return config, fmt.Errorf("could not resolve templates: %v", err)
+	}
+	err = yaml.Unmarshal(yamlConfig, &config)
+	if err != nil {
+		return config, err
+	}
+	err = config.setResolved(resolved)
+	if err != nil {
+		return config, fmt.Errorf("could not resolve templates: %v", err)
+	}
+	return config, nil
+}
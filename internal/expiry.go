@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/pg"
+	"sort"
+	"time"
+)
+
+/*
+ * This module handles relative expiry (expires_in) for password users, and warns about (and disables) users that are
+ * about to expire, or have expired.
+ */
+
+type FgaExpiryConfig struct {
+	Warning        Duration `yaml:"warning"`
+	NoLoginExpired bool     `yaml:"nologin_expired"`
+}
+
+// setUserExpiry sets the expiry of a password user. With expires_in, the expiry is set relative to when the password
+// was changed (as recorded in the state table), and a user without a password does not expire.
+func setUserExpiry(user *pg.Role, userConfig FgaUserConfig) (err error) {
+	expiresIn := time.Duration(userConfig.ExpiresIn)
+	if expiresIn <= 0 {
+		return user.SetExpiry(userConfig.Expiry)
+	}
+	changed, err := user.PasswordChanged()
+	if err != nil {
+		return err
+	}
+	if changed.IsZero() {
+		return user.ResetExpiry()
+	}
+	return user.SetExpiry(changed.Add(expiresIn))
+}
+
+// checkExpiry returns an error for users with both an expiry and expires_in
+func (pfh PgFgaHandler) checkExpiry() (err error) {
+	for userName, userConfig := range pfh.config.UserConfig {
+		if !userConfig.Expiry.IsZero() && userConfig.ExpiresIn > 0 {
+			return fmt.Errorf("expiry and expires_in cannot both be set for user %s", userName)
+		}
+	}
+	return nil
+}
+
+// handleExpiry warns about managed users that expire within the warning window (or have expired), and sets NOLOGIN
+// for expired users (when nologin_expired is set)
+func (pfh PgFgaHandler) handleExpiry() (err error) {
+	warning := time.Duration(pfh.config.ExpiryConfig.Warning)
+	if warning <= 0 {
+		return pfh.pg.HandleExpiredRoles()
+	}
+	expiries, err := pfh.pg.ExpiringRoles(warning)
+	if err != nil {
+		return err
+	}
+	var roleNames []string
+	for roleName := range expiries {
+		roleNames = append(roleNames, roleName)
+	}
+	sort.Strings(roleNames)
+	for _, roleName := range roleNames {
+		expiry := expiries[roleName]
+		if expiry.Before(time.Now()) {
+			log.Warnf("user %s has expired at %s", roleName, expiry.Format(time.RFC3339))
+		} else {
+			log.Warnf("user %s expires at %s (in %s)", roleName, expiry.Format(time.RFC3339),
+				time.Until(expiry).Truncate(time.Minute))
+		}
+	}
+	return pfh.pg.HandleExpiredRoles()
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"github.com/mannemsolutions/pgfga/pkg/pg"
+)
+
+/*
+ * This module reconciles the memberships (memberof) of all users and roles: declared memberships are granted, and
+ * (with strict users) memberships that are not declared are revoked.
+ */
+
+// grant grants a membership that is managed by pgfga for another reason than memberof (e.a. by a *-group, or
+// dual_roles), and records it, so that it is not revoked by HandleMemberships
+func (pfh PgFgaHandler) grant(memberName string, m pg.Membership) (err error) {
+	pfh.recordGrant(memberName, m.Role)
+	return pfh.pg.GrantMembership(memberName, m)
+}
+
+func (pfh PgFgaHandler) recordGrant(memberName string, grantedName string) {
+	if _, exists := pfh.grants[memberName]; !exists {
+		pfh.grants[memberName] = make(map[string]bool)
+	}
+	pfh.grants[memberName][grantedName] = true
+}
+
+// roleName returns the name of the role for a user, which differs from the name of the user for ldap-groups
+// (where the role is named after the group in ldap)
+func (pfh PgFgaHandler) roleName(userName string) string {
+	if roleName, exists := pfh.baseRoles[userName]; exists {
+		return roleName
+	}
+	return userName
+}
+
+// HandleMemberships grants the declared memberships of all users and roles, and (with strict users) revokes the
+// memberships that are not declared
+func (pfh PgFgaHandler) HandleMemberships() (err error) {
+	for _, db := range pfh.config.DbsConfig {
+		if !db.State.Bool() {
+			continue
+		}
+		for _, grant := range db.ImplicitGrants() {
+			pfh.recordGrant(grant.Member, grant.Granted)
+		}
+	}
+	for userName, userConfig := range pfh.config.UserConfig {
+		err = pfh.reconcileMemberships(pfh.roleName(userName), userConfig.State, userConfig.MemberOf)
+		if err != nil {
+			return err
+		}
+	}
+	for roleName, roleConfig := range pfh.config.Roles {
+		err = pfh.reconcileMemberships(roleName, roleConfig.State, roleConfig.MemberOf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pfh PgFgaHandler) reconcileMemberships(roleName string, state pg.State, memberOf []pg.Membership) (err error) {
+	if !state.Bool() {
+		return nil
+	}
+	declared := make(map[string]bool)
+	for _, membership := range memberOf {
+		declared[membership.Role] = true
+		err = pfh.pg.GrantMembership(roleName, membership)
+		if err != nil {
+			return err
+		}
+	}
+	if !pfh.config.StrictConfig.Users {
+		return nil
+	}
+	current, err := pfh.pg.GetRoleMemberships(roleName)
+	if err != nil {
+		return err
+	}
+	for _, grantedName := range current {
+		if declared[grantedName] || pfh.grants[roleName][grantedName] {
+			continue
+		}
+		log.Infof("revoking %s from %s, since it is not declared in memberof (config.strict.users is True)",
+			grantedName, roleName)
+		err = pfh.pg.RevokeRole(roleName, grantedName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+	"github.com/mannemsolutions/pgfga/pkg/pg"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * This module handles generated passwords, which are published to a sink (file, kubernetes secret or vault) instead
+ * of being set in the config file, and checks configured passwords against the password policy.
+ */
+
+const generatePassword = "generate"
+
+// dualRoleSuffixes are appended to the name of a user with dual_roles, to form the names of its login roles
+var dualRoleSuffixes = []string{"_a", "_b"}
+
+func isGeneratedPassword(password credential.Credential) bool {
+	return password.IsScalar() && password.Value == generatePassword
+}
+
+// setGeneratedPassword generates a new password when the password in the sink is not the password of the role
+// (e.a. on the first run), or when it is older than password_rotation. The new password is published to the sink
+// before it is set, so that it is never lost.
+func (pfh PgFgaHandler) setGeneratedPassword(userName string, userConfig FgaUserConfig,
+	user *pg.Role) (err error) {
+	sink := userConfig.PasswordSink
+	if !sink.IsSet() {
+		return fmt.Errorf("password_sink must be set for %s (password: %s)", userName, generatePassword)
+	}
+	password, generated, err := sink.Read()
+	if err != nil {
+		return fmt.Errorf("could not read password_sink for %s: %v", userName, err)
+	}
+	current, err := user.HasPassword(password)
+	if err != nil {
+		return err
+	}
+	rotation := time.Duration(userConfig.PasswordRotation)
+	switch {
+	case !current:
+		log.Infof("generating a new password for user %s", userName)
+	case rotation > 0 && time.Since(generated) > rotation:
+		log.Infof("rotating password for user %s (generated %s)", userName, generated.Format(time.RFC3339))
+	default:
+		log.Debugf("generated password for user %s is current", userName)
+		return nil
+	}
+	password, err = credential.GeneratePassword(userConfig.PasswordLength)
+	if err != nil {
+		return err
+	}
+	err = sink.Write(userName, userName, password)
+	if err != nil {
+		return fmt.Errorf("could not write password_sink for %s: %v", userName, err)
+	}
+	return user.SetPassword(password)
+}
+
+// handleDualRoles creates a role (without LOGIN) for a user with dual_roles, and two login roles (<user>_a and
+// <user>_b) that are a member of it. The current login role is the one that has the password from the sink. On
+// rotation, a new password is generated for the other (inactive) login role, which then becomes current, while the
+// previous one keeps working until the next rotation (or until password_grace has passed).
+func (pfh PgFgaHandler) handleDualRoles(userName string, userConfig FgaUserConfig, options pg.RoleOptions) (err error) {
+	if !isGeneratedPassword(userConfig.Password) {
+		return fmt.Errorf("dual_roles requires password: %s for %s", generatePassword, userName)
+	}
+	parentOptions := make(pg.RoleOptions)
+	parentOptions.AddOption(pg.LoginOption.Inverse())
+	parent, err := pg.NewRole(pfh.pg, userName, parentOptions, userConfig.State)
+	if err != nil {
+		return err
+	}
+	var users []*pg.Role
+	for _, suffix := range dualRoleSuffixes {
+		loginOptions := make(pg.RoleOptions)
+		for _, option := range options {
+			loginOptions.AddOption(option)
+		}
+		loginOptions.AddOption(pg.LoginOption)
+		user, err := pg.NewRole(pfh.pg, userName+suffix, loginOptions, userConfig.State)
+		if err != nil {
+			return err
+		}
+		users = append(users, user)
+	}
+	if !userConfig.State.Bool() {
+		return nil
+	}
+	err = parent.ResetPassword()
+	if err != nil {
+		return err
+	}
+	sink := userConfig.PasswordSink
+	if !sink.IsSet() {
+		return fmt.Errorf("password_sink must be set for %s (password: %s)", userName, generatePassword)
+	}
+	password, generated, err := sink.Read()
+	if err != nil {
+		return fmt.Errorf("could not read password_sink for %s: %v", userName, err)
+	}
+	current := -1
+	for i, user := range users {
+		err = pfh.grant(user.Name(), pg.Membership{Role: userName})
+		if err != nil {
+			return err
+		}
+		hasPassword, err := user.HasPassword(password)
+		if err != nil {
+			return err
+		}
+		if hasPassword {
+			current = i
+		}
+	}
+	rotation := time.Duration(userConfig.PasswordRotation)
+	grace := time.Duration(userConfig.PasswordGrace)
+	var next *pg.Role
+	switch {
+	case current < 0:
+		next = users[0]
+		log.Infof("generating a new password for user %s", next.Name())
+	case rotation > 0 && time.Since(generated) > rotation:
+		next = users[1-current]
+		log.Infof("rotating password for user %s (generated %s), %s becomes current", users[current].Name(),
+			generated.Format(time.RFC3339), next.Name())
+	case grace > 0 && time.Since(generated) > grace:
+		log.Debugf("grace period for user %s has passed", users[1-current].Name())
+		err = users[1-current].ResetPassword()
+	default:
+		log.Debugf("generated password for user %s is current", users[current].Name())
+	}
+	if err != nil {
+		return err
+	}
+	if next != nil {
+		password, err = credential.GeneratePassword(userConfig.PasswordLength)
+		if err != nil {
+			return err
+		}
+		err = sink.Write(userName, next.Name(), password)
+		if err != nil {
+			return fmt.Errorf("could not write password_sink for %s: %v", userName, err)
+		}
+		err = next.SetPassword(password)
+		if err != nil {
+			return err
+		}
+	}
+	for _, user := range users {
+		err = setUserExpiry(user, userConfig)
+		if err != nil {
+			return err
+		}
+		// configuration parameters are not inherited, so they are set on the login roles as well
+		err = pfh.setRoleSettings(user.Name(), userConfig.State, userConfig.Settings, userConfig.InDatabase)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPasswords checks all configured cleartext passwords against the password_policy, and returns an error listing
+// all users with a password that violates it. md5 hashed and generated passwords are not checked.
+func (pfh PgFgaHandler) checkPasswords() (err error) {
+	policy := pfh.config.PasswordPolicy
+	if !policy.IsSet() {
+		return nil
+	}
+	var userNames, violators []string
+	for userName := range pfh.config.UserConfig {
+		userNames = append(userNames, userName)
+	}
+	// sorted, so that violations are reported in the same order every run
+	sort.Strings(userNames)
+	for _, userName := range userNames {
+		userConfig := pfh.config.UserConfig[userName]
+		if userConfig.Auth != "password" && userConfig.Auth != "md5" {
+			continue
+		}
+		if !userConfig.State.Bool() || !userConfig.Password.IsSet() || isGeneratedPassword(userConfig.Password) {
+			continue
+		}
+		password, err := userConfig.Password.GetCred()
+		if err != nil {
+			return fmt.Errorf("could not get password for %s: %v", userName, err)
+		}
+		if pg.IsHashedPassword(password) {
+			log.Debugf("password for user %s is md5 hashed, and cannot be checked against the password_policy",
+				userName)
+			continue
+		}
+		violations, err := policy.Check(userName, password)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			log.Errorf("password for user %s violates the password_policy: %s", userName,
+				strings.Join(violations, ", "))
+			violators = append(violators, userName)
+		}
+	}
+	if len(violators) > 0 {
+		return fmt.Errorf("passwords for users %s violate the password_policy", strings.Join(violators, ", "))
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/identity"
 	"github.com/mannemsolutions/pgfga/pkg/ldap"
 	"github.com/mannemsolutions/pgfga/pkg/pg"
 	"go.uber.org/zap"
@@ -27,12 +28,33 @@ func Initialize() {
 
 	pg.Initialize(log)
 	ldap.Initialize(log)
+	identity.Initialize(log)
 }
 
 type PgFgaHandler struct {
 	config FgaConfig
 	pg     *pg.Handler
 	ldap   *ldap.Handler
+	// sources holds the identity source for every *-group auth type
+	sources map[string]identity.Source
+	// tmpDir holds temporary files (e.a. ssl keys from credentials), and is removed after running
+	tmpDir string
+	// grants holds the memberships granted for another reason than memberof (by member, and granted role)
+	grants map[string]map[string]bool
+	// baseRoles holds the name of the role for *-group users (by user name)
+	baseRoles map[string]string
+	// groups holds the members of *-group users (by user name), as resolved from their identity source by Plan
+	groups map[string]groupPlan
+}
+
+// groupPlan holds the group (name, or base dn for ldap) of a *-group user, the members it resolved to, and the
+// memberships to be granted and revoked for it
+type groupPlan struct {
+	group     string
+	baseGroup *ldap.Member
+	// grants holds all roles that are managed by this group, with the members they should be granted to
+	grants  map[string]map[string]bool
+	revokes []revoke
 }
 
 func NewPgFgaHandler() (pfh *PgFgaHandler, err error) {
@@ -44,111 +66,508 @@ func NewPgFgaHandler() (pfh *PgFgaHandler, err error) {
 	atom.SetLevel(config.GeneralConfig.LogLevel)
 
 	pfh = &PgFgaHandler{
-		config: config,
+		config:    config,
+		grants:    make(map[string]map[string]bool),
+		baseRoles: make(map[string]string),
+		groups:    make(map[string]groupPlan),
 	}
 
 	pfh.ldap = ldap.NewLdapHandler(config.LdapConfig)
+	pfh.sources = map[string]identity.Source{
+		"ldap-group": pfh.ldap,
+		"file-group": identity.NewFileSource(config.FileGroups),
+		"unix-group": identity.NewUnixSource(config.UnixGroups),
+		"http-group": identity.NewHttpSource(config.HttpGroups),
+		"scim-group": identity.NewScimSource(config.ScimGroups),
+	}
 
-	pfh.pg = pg.NewPgHandler(config.PgDsn, config.StrictConfig, config.DbsConfig, config.Slots)
+	dsn, tmpDir, err := config.PgDsn.Dsn()
+	pfh.tmpDir = tmpDir
+	if err != nil {
+		pfh.cleanup()
+		return nil, err
+	}
+	pfh.pg = pg.NewPgHandler(dsn, config.StrictConfig, config.DbsConfig, config.Slots)
+	pfh.pg.SetNoLoginExpired(config.ExpiryConfig.NoLoginExpired)
 
 	return pfh, nil
 }
 
+// cleanup removes temporary files (e.a. ssl keys from credentials)
+func (pfh PgFgaHandler) cleanup() {
+	if pfh.tmpDir == "" {
+		return
+	}
+	err := os.RemoveAll(pfh.tmpDir)
+	if err != nil {
+		log.Errorf("could not remove %s: %v", pfh.tmpDir, err)
+	}
+}
+
+// fatal cleans up and exits
+func (pfh PgFgaHandler) fatal(err error) {
+	pfh.cleanup()
+	log.Fatal(err)
+}
+
 func (pfh PgFgaHandler) Handle() {
 	time.Sleep(pfh.config.GeneralConfig.RunDelay)
 
-	err := pfh.HandleRoles()
+	err := pfh.Validate()
 	if err != nil {
-		log.Fatal(err)
+		pfh.fatal(err)
+	}
+	err = pfh.Plan()
+	if err != nil {
+		pfh.fatal(err)
+	}
+	if pfh.config.GeneralConfig.DryRun {
+		log.Infof("dry run, not applying any changes")
+		pfh.cleanup()
+		return
+	}
+	err = pfh.HandleRoles()
+	if err != nil {
+		pfh.fatal(err)
 	}
 	err = pfh.HandleUsers()
 	if err != nil {
-		log.Fatal(err)
+		pfh.fatal(err)
+	}
+	err = pfh.HandleMemberships()
+	if err != nil {
+		pfh.fatal(err)
+	}
+	err = pfh.handleExpiry()
+	if err != nil {
+		pfh.fatal(err)
 	}
 	err = pfh.HandleDatabases()
 	if err != nil {
-		log.Fatal(err)
+		pfh.fatal(err)
+	}
+	err = pfh.pg.StrictifyDatabases(pfh.checkDrops)
+	if err != nil {
+		pfh.fatal(err)
+	}
+	err = pfh.pg.StrictifyRoles(pfh.checkDrops)
+	if err != nil {
+		pfh.fatal(err)
 	}
 	err = pfh.HandleSlots()
 	if err != nil {
-		log.Fatal(err)
+		pfh.fatal(err)
 	}
+	pfh.cleanup()
+}
+
+// Validate checks the config before any changes are made
+func (pfh PgFgaHandler) Validate() (err error) {
+	err = pfh.reportTemplates()
+	if err != nil {
+		return err
+	}
+	checks := []func() error{
+		pfh.checkPasswords,
+		pfh.checkRoleOptions,
+		pfh.checkMemberships,
+		pfh.checkMemberComments,
+		pfh.checkExpiry,
+	}
+	var problems int
+	for _, check := range checks {
+		err = check()
+		if err == nil {
+			continue
+		}
+		if !pfh.config.GeneralConfig.DryRun {
+			return err
+		}
+		// A dry run reports all problems, instead of stopping at the first one
+		log.Error(err)
+		problems++
+	}
+	if problems > 0 {
+		return fmt.Errorf("validation found %d problem(s)", problems)
+	}
+	if pfh.config.GeneralConfig.DryRun {
+		log.Infof("config is valid")
+	}
+	return nil
+}
+
+// checkMemberships checks that all configured membership options are supported by the server version
+func (pfh PgFgaHandler) checkMemberships() (err error) {
+	var memberships []pg.Membership
+	for _, userConfig := range pfh.config.UserConfig {
+		memberships = append(memberships, userConfig.MemberOf...)
+		memberships = append(memberships, userConfig.MemberMemberOf...)
+	}
+	for _, roleConfig := range pfh.config.Roles {
+		memberships = append(memberships, roleConfig.MemberOf...)
+	}
+	for _, membership := range memberships {
+		err = pfh.pg.ValidateMembership(membership)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRoleOptions checks that all configured role options are valid, and supported by the server version
+func (pfh PgFgaHandler) checkRoleOptions() (err error) {
+	var optionLists [][]string
+	for _, userConfig := range pfh.config.UserConfig {
+		optionLists = append(optionLists, userConfig.Options, userConfig.MemberOptions)
+	}
+	for _, roleConfig := range pfh.config.Roles {
+		optionLists = append(optionLists, roleConfig.Options)
+	}
+	for _, optionList := range optionLists {
+		options, err := pg.NewRoleOptions(optionList)
+		if err != nil {
+			return err
+		}
+		err = pfh.pg.ValidateRoleOptions(options)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (pfh PgFgaHandler) HandleUsers() (err error) {
 	for userName, userConfig := range pfh.config.UserConfig {
-		options := make(pg.RoleOptions)
-		for _, optionName := range userConfig.Options {
-			option, err := pg.NewRoleOption(optionName)
-			if err != nil {
-				return err
-			}
-			options[optionName] = option
+		options, err := pg.NewRoleOptions(userConfig.Options)
+		if err != nil {
+			return err
 		}
 		switch userConfig.Auth {
-		case "ldap-group":
-			log.Debugf("Configuring role from ldap for %s", userName)
-			if userConfig.BaseDN == "" || userConfig.Filter == "" {
-				return fmt.Errorf("ldapbasedn and ldapfilter must be set for %s (auth: 'ldap-group')", userName)
-			}
-			baseGroup, err := pfh.ldap.GetMembers(userConfig.BaseDN, userConfig.Filter)
+		case "ldap-group", "file-group", "unix-group", "http-group", "scim-group":
+			err = pfh.handleGroup(userName, userConfig, options)
 			if err != nil {
 				return err
 			}
-			baseRole, err := pg.NewRole(pfh.pg, baseGroup.Name(), options, userConfig.State)
+		case "ldap-user", "clientcert":
+			log.Debugf("Configuring user %s with %s", userName, userConfig.Auth)
+			options.AddOption(pg.LoginOption)
+			user, err := pg.NewRole(pfh.pg, userName, options, userConfig.State)
 			if err != nil {
 				return err
 			}
-			err = baseRole.ResetPassword()
+			err = user.ResetPassword()
 			if err != nil {
 				return err
 			}
-			for _, ms := range baseGroup.MembershipTree() {
-				_, err = pg.NewRole(pfh.pg, ms.Member.Name(), pg.LoginOptions, userConfig.State)
-				if err != nil {
-					return err
-				}
-				err = pfh.pg.GrantRole(ms.Member.Name(), baseGroup.Name())
+		case "password", "md5":
+			if userConfig.DualRoles {
+				err = pfh.handleDualRoles(userName, userConfig, options)
 				if err != nil {
 					return err
 				}
+				break
 			}
-		case "ldap-user", "clientcert":
-			log.Debugf("Configuring user %s with %s", userName, userConfig.Auth)
 			options.AddOption(pg.LoginOption)
 			user, err := pg.NewRole(pfh.pg, userName, options, userConfig.State)
 			if err != nil {
 				return err
 			}
-			err = user.ResetPassword()
-			if err != nil {
-				return err
-			}
-			if userConfig.State.Bool() {
-				for _, granted := range userConfig.MemberOf {
-					err := pfh.pg.GrantRole(userName, granted)
+			if userConfig.State.Bool() && isGeneratedPassword(userConfig.Password) {
+				err = pfh.setGeneratedPassword(userName, userConfig, user)
+				if err != nil {
+					return err
+				}
+			} else {
+				var password string
+				if userConfig.Password.IsSet() {
+					password, err = userConfig.Password.GetCred()
 					if err != nil {
-						return err
+						return fmt.Errorf("could not get password for %s: %v", userName, err)
 					}
 				}
+				// Note: if no password is set, it will be reset...
+				err = user.SetPassword(password)
+				if err != nil {
+					return err
+				}
 			}
-		case "password", "md5":
-			options.AddOption(pg.LoginOption)
-			user, err := pg.NewRole(pfh.pg, userName, options, userConfig.State)
+			err = setUserExpiry(user, userConfig)
 			if err != nil {
 				return err
 			}
-			// Note: if no password is set, it will be reset...
-			err = user.SetPassword(userConfig.Password)
-			if err != nil {
-				return err
+		default:
+			log.Fatalf("Invalid auth %s for user %s", userConfig.Auth, userName)
+		}
+		err = pfh.setRoleSettings(pfh.roleName(userName), userConfig.State, userConfig.Settings,
+			userConfig.InDatabase)
+		if err != nil {
+			return err
+		}
+		err = pfh.setRoleMetadata(pfh.roleName(userName), userConfig.State, userConfig.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRoleSettings sets the configuration parameters (settings, and per database in_database) for a role
+func (pfh PgFgaHandler) setRoleSettings(roleName string, state pg.State, settings map[string]string,
+	inDatabase map[string]map[string]string) (err error) {
+	if !state.Bool() {
+		return nil
+	}
+	roleSettings := pg.RoleSettings{"": settings}
+	for dbName, dbSettings := range inDatabase {
+		if dbName == "" {
+			return fmt.Errorf("in_database for role %s has a setting without a database name", roleName)
+		}
+		roleSettings[dbName] = dbSettings
+	}
+	role, err := pfh.pg.GetRole(roleName)
+	if err != nil {
+		return err
+	}
+	return role.SetSettings(roleSettings)
+}
+
+// getGroupMembers reads the members of a *-group user from its identity source. Members are read once every run, and
+// the same members are returned when they are requested again.
+func (pfh PgFgaHandler) getGroupMembers(userName string, userConfig FgaUserConfig) (group string,
+	baseGroup *ldap.Member, err error) {
+	if plan, exists := pfh.groups[userName]; exists {
+		return plan.group, plan.baseGroup, nil
+	}
+	group = userConfig.Group
+	if userConfig.Auth == "ldap-group" {
+		if userConfig.BaseDN == "" || userConfig.Filter == "" {
+			return "", nil, fmt.Errorf("ldapbasedn and ldapfilter must be set for %s (auth: 'ldap-group')", userName)
+		}
+		group = userConfig.BaseDN
+	} else if group == "" {
+		group = userName
+	}
+	baseGroup, err = pfh.sources[userConfig.Auth].GetMembers(group, userConfig.Filter)
+	if err != nil {
+		return "", nil, err
+	}
+	pfh.groups[userName] = groupPlan{group: group, baseGroup: baseGroup}
+	return group, baseGroup, nil
+}
+
+// Plan resolves the members of all *-group users (also when they are absent) before any changes are made, and
+// saves the ldap snapshot. The resolved members (from all identity sources) are reused when applying, so that the
+// plan (and a recorded snapshot) holds exactly the state that is applied.
+func (pfh PgFgaHandler) Plan() (err error) {
+	for userName, userConfig := range pfh.config.UserConfig {
+		if _, isGroup := pfh.sources[userConfig.Auth]; !isGroup {
+			continue
+		}
+		_, baseGroup, err := pfh.getGroupMembers(userName, userConfig)
+		if err != nil {
+			return err
+		}
+		pfh.baseRoles[userName] = baseGroup.Name()
+		log.Infof("%s %s resolves to %d memberships", userConfig.Auth, userName, len(baseGroup.MembershipTree()))
+	}
+	// revokes are planned once all groups are resolved (so that the roles of all groups are known), and before any
+	// changes are made, so that a group that trips a safety guard aborts the run before anything is applied
+	for userName, userConfig := range pfh.config.UserConfig {
+		if _, isGroup := pfh.sources[userConfig.Auth]; !isGroup {
+			continue
+		}
+		err = pfh.planGroup(userName, userConfig)
+		if err != nil {
+			return err
+		}
+	}
+	return pfh.ldap.SaveSnapshot()
+}
+
+// planGroup sets the memberships to be granted for a *-group user, and (with strict users) the memberships to be
+// revoked. It returns an error when a safety guard is tripped.
+func (pfh PgFgaHandler) planGroup(userName string, userConfig FgaUserConfig) (err error) {
+	plan := pfh.groups[userName]
+	baseGroup := plan.baseGroup
+	memberships := baseGroup.MembershipTree()
+	plan.grants = map[string]map[string]bool{baseGroup.Name(): {}}
+	for _, ms := range memberships {
+		grantedName := baseGroup.Name()
+		if userConfig.MirrorGroups {
+			// Mirror the group tree: every (sub)group is a role, and members are granted their direct parent
+			grantedName = ms.MemberOf.Name()
+			if ms.Member.GetMType() == ldap.GroupMType {
+				if _, exists := plan.grants[ms.Member.Name()]; !exists {
+					plan.grants[ms.Member.Name()] = make(map[string]bool)
+				}
 			}
-			err = user.SetExpiry(userConfig.Expiry)
+		}
+		if _, exists := plan.grants[grantedName]; !exists {
+			plan.grants[grantedName] = make(map[string]bool)
+		}
+		plan.grants[grantedName][ms.Member.Name()] = true
+	}
+	if pfh.config.StrictConfig.Users && userConfig.State.Bool() {
+		err = pfh.checkEmptyGroup(userName, len(memberships))
+		if err != nil {
+			return err
+		}
+		plan.revokes, err = pfh.getRevokes(plan.grants)
+		if err != nil {
+			return err
+		}
+	}
+	pfh.groups[userName] = plan
+	return nil
+}
+
+// handleGroup creates a role for a group from an identity source (ldap, file, etc.), and users for all of its
+// members. With strict users, memberships that are not (or no longer) in the identity source are revoked.
+func (pfh PgFgaHandler) handleGroup(userName string, userConfig FgaUserConfig, options pg.RoleOptions) (err error) {
+	log.Debugf("Configuring role from %s for %s", userConfig.Auth, userName)
+	group, baseGroup, err := pfh.getGroupMembers(userName, userConfig)
+	if err != nil {
+		return err
+	}
+	if pfh.groups[userName].grants == nil {
+		err = pfh.planGroup(userName, userConfig)
+		if err != nil {
+			return err
+		}
+	}
+	plan := pfh.groups[userName]
+	memberships := baseGroup.MembershipTree()
+
+	baseRole, err := pg.NewRole(pfh.pg, baseGroup.Name(), options, userConfig.State)
+	if err != nil {
+		return err
+	}
+	err = baseRole.ResetPassword()
+	if err != nil {
+		return err
+	}
+	for _, ms := range memberships {
+		if userConfig.MirrorGroups && ms.Member.GetMType() == ldap.GroupMType {
+			err = pfh.handleSubGroup(ms.Member, userConfig)
+		} else {
+			err = pfh.handleGroupUser(ms.Member, userConfig, memberCommentData{
+				User:   ms.Member.Name(),
+				Group:  group,
+				Role:   baseGroup.Name(),
+				Source: userConfig.Auth,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for grantedName, members := range plan.grants {
+		for memberName := range members {
+			err = pfh.grant(memberName, pg.Membership{Role: grantedName})
 			if err != nil {
 				return err
 			}
-		default:
-			log.Fatalf("Invalid auth %s for user %s", userConfig.Auth, userName)
+		}
+	}
+	for _, r := range plan.revokes {
+		err = pfh.pg.RevokeRole(r.member, r.granted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSubGroup creates a role (without LOGIN) for a group that is a member of a *-group
+func (pfh PgFgaHandler) handleSubGroup(group *ldap.Member, groupConfig FgaUserConfig) (err error) {
+	options := make(pg.RoleOptions)
+	options.AddOption(pg.LoginOption.Inverse())
+	role, err := pg.NewRole(pfh.pg, group.Name(), options, groupConfig.State)
+	if err != nil {
+		return err
+	}
+	if !groupConfig.State.Bool() {
+		return nil
+	}
+	return role.ResetPassword()
+}
+
+// handleGroupUser creates a login role for a user (member of a *-group), with the member_* settings from
+// the group config, and (for ldap-group) the settings mapped from its ldap attributes (which take precedence)
+func (pfh PgFgaHandler) handleGroupUser(member *ldap.Member, groupConfig FgaUserConfig,
+	commentData memberCommentData) (err error) {
+	var settings ldap.UserSettings
+	if groupConfig.Auth == "ldap-group" {
+		settings, err = pfh.ldap.UserSettings(member)
+		if err != nil {
+			return err
+		}
+	}
+	options := make(pg.RoleOptions)
+	options.AddOption(pg.LoginOption)
+	memberOptions, err := pg.NewRoleOptions(groupConfig.MemberOptions)
+	if err != nil {
+		return err
+	}
+	for _, option := range memberOptions {
+		options.AddOption(option)
+	}
+	if settings.Disabled {
+		log.Infof("user %s is disabled in ldap, setting NOLOGIN", member.Name())
+		options.AddOption(pg.LoginOption.Inverse())
+	}
+	user, err := pg.NewRole(pfh.pg, member.Name(), options, groupConfig.State)
+	if err != nil {
+		return err
+	}
+	if !groupConfig.State.Bool() {
+		return nil
+	}
+	expiry, hasExpiry := groupConfig.MemberExpiry, !groupConfig.MemberExpiry.IsZero()
+	if settings.HasExpiry {
+		// The earliest expiry wins
+		if !hasExpiry || (!settings.Expiry.IsZero() && settings.Expiry.Before(expiry)) {
+			expiry = settings.Expiry
+		}
+		hasExpiry = true
+	}
+	if hasExpiry {
+		err = user.SetExpiry(expiry)
+		if err != nil {
+			return err
+		}
+	}
+	connLimit, hasConnLimit := -1, false
+	if groupConfig.MemberConnectionLimit != nil {
+		connLimit, hasConnLimit = *groupConfig.MemberConnectionLimit, true
+	}
+	if settings.HasConnectionLimit && (settings.ConnectionLimit != -1 || !hasConnLimit) {
+		connLimit, hasConnLimit = settings.ConnectionLimit, true
+	}
+	if hasConnLimit {
+		err = user.SetConnectionLimit(connLimit)
+		if err != nil {
+			return err
+		}
+	}
+	if !settings.HasComment && groupConfig.MemberComment != "" {
+		settings.Comment, err = commentData.render(groupConfig.MemberComment)
+		if err != nil {
+			return err
+		}
+		settings.HasComment = true
+	}
+	if settings.HasComment {
+		err = user.SetComment(settings.Comment)
+		if err != nil {
+			return err
+		}
+	}
+	for _, granted := range groupConfig.MemberMemberOf {
+		err = pfh.grant(member.Name(), granted)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -160,27 +579,21 @@ func (pfh PgFgaHandler) HandleDatabases() (err error) {
 
 func (pfh PgFgaHandler) HandleRoles() (err error) {
 	for roleName, roleConfig := range pfh.config.Roles {
-		options := make(pg.RoleOptions)
-		for _, optionName := range roleConfig.Options {
-			option, err := pg.NewRoleOption(optionName)
-			if err != nil {
-				return err
-			}
-			options[optionName] = option
+		options, err := pg.NewRoleOptions(roleConfig.Options)
+		if err != nil {
+			return err
 		}
-		role, err := pg.NewRole(pfh.pg, roleName, options, roleConfig.State)
+		_, err = pg.NewRole(pfh.pg, roleName, options, roleConfig.State)
 		if err != nil {
 			return err
 		}
-		for _, groupName := range roleConfig.MemberOf {
-			group, err := pfh.pg.GetRole(groupName)
-			if err != nil {
-				return err
-			}
-			err = role.GrantRole(group)
-			if err != nil {
-				return err
-			}
+		err = pfh.setRoleSettings(roleName, roleConfig.State, roleConfig.Settings, roleConfig.InDatabase)
+		if err != nil {
+			return err
+		}
+		err = pfh.setRoleMetadata(roleName, roleConfig.State, roleConfig.Metadata)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ * This module holds the guards that protect against mass revocation when an identity source (e.a. ldap) returns
+ * empty or partial results.
+ */
+
+type FgaSafetyConfig struct {
+	AllowEmptyGroups      bool `yaml:"allow_empty_groups"`
+	MaxRevocations        int  `yaml:"max_revocations"`
+	MaxRevocationsPercent int  `yaml:"max_revocations_percent"`
+	// Override is set with the -f commandline argument and skips all guards
+	Override bool `yaml:"-"`
+}
+
+type revoke struct {
+	member  string
+	granted string
+}
+
+// checkEmptyGroup returns an error when a *-group has no members at all (which is probably an identity source issue)
+func (pfh PgFgaHandler) checkEmptyGroup(userName string, numMembers int) (err error) {
+	safety := pfh.config.SafetyConfig
+	if numMembers > 0 || safety.AllowEmptyGroups {
+		return nil
+	}
+	if safety.Override {
+		log.Warnf("group %s has no members, continuing since safety guards are overridden", userName)
+		return nil
+	}
+	return fmt.Errorf("group %s has no members, refusing to revoke all memberships "+
+		"(set safety.allow_empty_groups, or run with -f to override)", userName)
+}
+
+// declaredMembers returns all roles that are configured (memberof) to be a member of grantedName.
+// These are never revoked as part of a *-group.
+func (pfh PgFgaHandler) declaredMembers(grantedName string) (members map[string]bool) {
+	members = make(map[string]bool)
+	for userName, userConfig := range pfh.config.UserConfig {
+		for _, granted := range userConfig.MemberOf {
+			if granted.Role == grantedName {
+				members[pfh.roleName(userName)] = true
+			}
+		}
+	}
+	for roleName, roleConfig := range pfh.config.Roles {
+		for _, granted := range roleConfig.MemberOf {
+			if granted.Role == grantedName {
+				members[roleName] = true
+			}
+		}
+	}
+	return members
+}
+
+// getRevokes compares the memberships from the identity source (grants) to the memberships in pg_auth_members, and
+// returns all memberships that should be revoked. When the number of revokes exceeds the configured thresholds, an
+// error is returned instead.
+func (pfh PgFgaHandler) getRevokes(grants map[string]map[string]bool) (revokes []revoke, err error) {
+	var numCurrent int
+	for grantedName, members := range grants {
+		current, err := pfh.pg.GetRoleMembers(grantedName)
+		if err != nil {
+			return nil, err
+		}
+		numCurrent += len(current)
+		declared := pfh.declaredMembers(grantedName)
+		for _, memberName := range current {
+			if members[memberName] || declared[memberName] {
+				continue
+			}
+			revokes = append(revokes, revoke{member: memberName, granted: grantedName})
+		}
+	}
+	err = pfh.checkThresholds("memberships to be revoked", len(revokes), numCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return revokes, nil
+}
+
+// checkDrops guards strict cleanup with the same thresholds as revocations (max_revocations and
+// max_revocations_percent), so that a config error does not drop all unmanaged roles or databases in one run
+func (pfh PgFgaHandler) checkDrops(objectType string, drops []string, existing int) (err error) {
+	if len(drops) == 0 {
+		return nil
+	}
+	sort.Strings(drops)
+	log.Infof("strict cleanup drops %d %s(s): %s", len(drops), objectType, strings.Join(drops, ", "))
+	return pfh.checkThresholds(objectType+"s to be dropped", len(drops), existing)
+}
+
+// checkThresholds returns an error when the number of changes (out of total) exceeds max_revocations or
+// max_revocations_percent (unless the guards are overridden with -f)
+func (pfh PgFgaHandler) checkThresholds(description string, changes int, total int) (err error) {
+	safety := pfh.config.SafetyConfig
+	var exceeded string
+	if safety.MaxRevocations > 0 && changes > safety.MaxRevocations {
+		exceeded = fmt.Sprintf("%d %s exceeds max_revocations %d", changes, description, safety.MaxRevocations)
+	} else if safety.MaxRevocationsPercent > 0 && changes*100 > safety.MaxRevocationsPercent*total {
+		exceeded = fmt.Sprintf("%d of %d %s exceeds max_revocations_percent %d%%", changes, total, description,
+			safety.MaxRevocationsPercent)
+	}
+	if exceeded == "" {
+		return nil
+	}
+	if safety.Override {
+		log.Warnf("%s, continuing since safety guards are overridden", exceeded)
+		return nil
+	}
+	return fmt.Errorf("%s (run with -f to override)", exceeded)
+}
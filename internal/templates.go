@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * This module resolves the templates section of the config. Users and roles can reference one or more templates
+ * (with `templates`), which provide defaults for their fields. Templates are applied in order, and the local fields
+ * of the user or role are merged on top. Maps (like settings) are merged, all other values are replaced.
+ */
+
+const (
+	templatesKey = "templates"
+	redacted     = "<redacted>"
+)
+
+type yamlMap = map[interface{}]interface{}
+
+// templateSections holds the sections of the config that can reference templates, with the fields that can be set
+var templateSections = map[string]map[string]bool{
+	"users": withKeys(yamlKeys(reflect.TypeOf(FgaUserConfig{})), templatesKey),
+	// member is an alias for memberof
+	"roles": withKeys(yamlKeys(reflect.TypeOf(FgaRoleConfig{})), templatesKey, "member"),
+}
+
+// yamlKeys returns the yaml keys of all fields of a struct (including the fields of inline structs)
+func yamlKeys(t reflect.Type) (keys map[string]bool) {
+	keys = make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			for key := range yamlKeys(field.Type) {
+				keys[key] = true
+			}
+		} else if tag[0] != "" && tag[0] != "-" {
+			keys[tag[0]] = true
+		}
+	}
+	return keys
+}
+
+func withKeys(keys map[string]bool, extra ...string) map[string]bool {
+	for _, key := range extra {
+		keys[key] = true
+	}
+	return keys
+}
+
+// yamlValue decodes a yaml value like interface{} does, except that plain (unquoted) timestamps are decoded as
+// time.Time instead of as a string. That way, a resolved entry can be marshalled and decoded again, without date-only
+// values (e.a. expiry: 2022-01-01) turning into strings that can no longer be decoded into a time.Time.
+type yamlValue struct {
+	value interface{}
+}
+
+func (v *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&v.value); err != nil {
+		return err
+	}
+	switch v.value.(type) {
+	case yamlMap:
+		var entries map[interface{}]yamlValue
+		if err := unmarshal(&entries); err != nil {
+			return err
+		}
+		m := make(yamlMap)
+		for key, value := range entries {
+			m[key] = value.value
+		}
+		v.value = m
+	case []interface{}:
+		var items []yamlValue
+		if err := unmarshal(&items); err != nil {
+			return err
+		}
+		var l []interface{}
+		for _, item := range items {
+			l = append(l, item.value)
+		}
+		v.value = l
+	case string:
+		var timestamp time.Time
+		if err := unmarshal(&timestamp); err == nil {
+			v.value = timestamp
+		}
+	}
+	return nil
+}
+
+// templatesConfig holds the parts of the config that are needed to resolve templates
+type templatesConfig struct {
+	Templates map[string]yamlValue            `yaml:"templates"`
+	Users     map[string]map[string]yamlValue `yaml:"users"`
+	Roles     map[string]map[string]yamlValue `yaml:"roles"`
+}
+
+func toYamlMap(values map[string]yamlValue) (m yamlMap) {
+	m = make(yamlMap)
+	for key, value := range values {
+		m[key] = value.value
+	}
+	return m
+}
+
+// resolveTemplates returns all users and roles that reference templates (by section and name), with all templates
+// applied. Users and roles that don't reference templates are not returned, and are decoded from the config as is.
+func resolveTemplates(yamlConfig []byte) (resolved map[string]map[string]yamlMap, err error) {
+	var config templatesConfig
+	err = yaml.Unmarshal(yamlConfig, &config)
+	if err != nil {
+		return nil, err
+	}
+	templates := make(yamlMap)
+	for name, template := range config.Templates {
+		templates[name] = template.value
+	}
+	resolved = make(map[string]map[string]yamlMap)
+	for section, entries := range map[string]map[string]map[string]yamlValue{
+		"users": config.Users,
+		"roles": config.Roles,
+	} {
+		resolved[section] = make(map[string]yamlMap)
+		for name, entry := range entries {
+			if _, exists := entry[templatesKey]; !exists {
+				continue
+			}
+			merged, err := applyTemplates(templates, section, toYamlMap(entry), nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", section, name, err)
+			}
+			resolved[section][name] = merged
+		}
+	}
+	return resolved, nil
+}
+
+// decodeYamlMap decodes a resolved entry into out (a FgaUserConfig or a FgaRoleConfig)
+func decodeYamlMap(entry yamlMap, out interface{}) (err error) {
+	data, err := yaml.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, out)
+}
+
+// setResolved replaces the users and roles that reference templates by their resolved config
+func (config *FgaConfig) setResolved(resolved map[string]map[string]yamlMap) (err error) {
+	config.resolved = resolved
+	for name, entry := range resolved["users"] {
+		var userConfig FgaUserConfig
+		err = decodeYamlMap(entry, &userConfig)
+		if err != nil {
+			return fmt.Errorf("users.%s: %v", name, err)
+		}
+		userConfig.Templates, _ = templateNames(entry)
+		config.UserConfig[name] = userConfig
+	}
+	for name, entry := range resolved["roles"] {
+		var roleConfig FgaRoleConfig
+		err = decodeYamlMap(entry, &roleConfig)
+		if err != nil {
+			return fmt.Errorf("roles.%s: %v", name, err)
+		}
+		roleConfig.Templates, _ = templateNames(entry)
+		config.Roles[name] = roleConfig
+	}
+	return nil
+}
+
+// templateNames returns the templates referenced by an entry (as a single name, or as a list of names)
+func templateNames(entry yamlMap) (names []string, err error) {
+	switch value := entry[templatesKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []string:
+		return value, nil
+	case []interface{}:
+		for _, name := range value {
+			nameString, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid template name %v", name)
+			}
+			names = append(names, nameString)
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("templates should be a name, or a list of names")
+	}
+}
+
+// applyTemplates merges all templates referenced by entry (which can reference templates themselves), and entry
+// itself on top. Templates can only set the fields of the section (users or roles) that entry belongs to.
+func applyTemplates(templates yamlMap, section string, entry yamlMap, parents []string) (merged yamlMap,
+	err error) {
+	names, err := templateNames(entry)
+	if err != nil {
+		return nil, err
+	}
+	merged = make(yamlMap)
+	for _, name := range names {
+		for _, parent := range parents {
+			if parent == name {
+				return nil, fmt.Errorf("template %s references itself (%s)", name,
+					strings.Join(append(parents, name), " -> "))
+			}
+		}
+		template, exists := templates[name]
+		if !exists {
+			return nil, fmt.Errorf("template %s does not exist", name)
+		}
+		templateMap, ok := template.(yamlMap)
+		if !ok {
+			return nil, fmt.Errorf("template %s should be an object", name)
+		}
+		for key := range templateMap {
+			if !templateSections[section][fmt.Sprint(key)] {
+				return nil, fmt.Errorf("template %s sets %v, which cannot be set for %s", name, key, section)
+			}
+		}
+		resolved, err := applyTemplates(templates, section, templateMap, append(parents, name))
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeYamlMaps(merged, resolved)
+	}
+	merged = mergeYamlMaps(merged, entry)
+	// templates is normalized to the list of templates that are referenced directly
+	delete(merged, templatesKey)
+	if len(names) > 0 {
+		merged[templatesKey] = names
+	}
+	return merged, nil
+}
+
+// mergeYamlMaps returns a new map with all values from src merged on top of dst
+func mergeYamlMaps(dst yamlMap, src yamlMap) (merged yamlMap) {
+	merged = make(yamlMap)
+	for key, value := range dst {
+		merged[key] = value
+	}
+	for key, value := range src {
+		srcMap, srcIsMap := value.(yamlMap)
+		dstMap, dstIsMap := merged[key].(yamlMap)
+		if srcIsMap && dstIsMap {
+			merged[key] = mergeYamlMaps(dstMap, srcMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// redactPassword returns a copy of a resolved user, with the password value replaced (when it is set directly)
+func redactPassword(entry yamlMap) (redactedEntry yamlMap) {
+	redactedEntry = mergeYamlMaps(entry, nil)
+	switch password := entry["password"].(type) {
+	case string:
+		if password != generatePassword {
+			redactedEntry["password"] = redacted
+		}
+	case yamlMap:
+		if _, exists := password["value"]; exists {
+			redactedEntry["password"] = mergeYamlMaps(password, yamlMap{"value": redacted})
+		}
+	}
+	return redactedEntry
+}
+
+// reportTemplates reports the resolved config of all users and roles that reference templates (at info level in a
+// dry run, and at debug level otherwise)
+func (pfh PgFgaHandler) reportTemplates() (err error) {
+	report := log.Debugf
+	if pfh.config.GeneralConfig.DryRun {
+		report = log.Infof
+	}
+	for _, section := range []string{"roles", "users"} {
+		entries := pfh.config.resolved[section]
+		var names []string
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data, err := yaml.Marshal(redactPassword(entries[name]))
+			if err != nil {
+				return err
+			}
+			report("%s.%s resolved from templates:\n%s", section, name, data)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const templatesConfigYaml = `
+templates:
+  app:
+    auth: password
+    options: [LOGIN]
+    memberof: [readonly]
+    expiry: 2030-01-01
+    settings:
+      statement_timeout: 30s
+      work_mem: 4MB
+  writer:
+    templates: app
+    memberof: [readwrite]
+  group:
+    memberof: [readonly]
+    comment: "2022-01-01"
+users:
+  app1:
+    templates: writer
+    settings:
+      statement_timeout: 5min
+  app2:
+    templates: [app]
+    auth: md5
+  backup_user:
+    auth: password
+    expiry: 2022-01-01
+roles:
+  reporting:
+    templates: group
+`
+
+func TestParseConfigTemplates(t *testing.T) {
+	config, err := parseConfig([]byte(templatesConfigYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app1 := config.UserConfig["app1"]
+	if app1.Auth != "password" || !reflect.DeepEqual(app1.Options, []string{"LOGIN"}) {
+		t.Errorf("app1 does not have the fields of template app: %v", app1)
+	}
+	if len(app1.MemberOf) != 1 || app1.MemberOf[0].Role != "readwrite" {
+		t.Errorf("expected memberof of template writer to replace memberof of template app, got %v", app1.MemberOf)
+	}
+	expectedSettings := map[string]string{"statement_timeout": "5min", "work_mem": "4MB"}
+	if !reflect.DeepEqual(app1.Settings, expectedSettings) {
+		t.Errorf("expected settings %v, got %v", expectedSettings, app1.Settings)
+	}
+	if !reflect.DeepEqual(app1.Templates, []string{"writer"}) {
+		t.Errorf("expected templates [writer], got %v", app1.Templates)
+	}
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !app1.Expiry.Equal(expiry) {
+		t.Errorf("expected expiry %s, got %s", expiry, app1.Expiry)
+	}
+	if config.UserConfig["app2"].Auth != "md5" {
+		t.Errorf("expected the auth of app2 to override the auth of template app")
+	}
+	backup := config.UserConfig["backup_user"]
+	if !backup.Expiry.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the date-only expiry of backup_user to be kept, got %s", backup.Expiry)
+	}
+	reporting := config.Roles["reporting"]
+	if len(reporting.MemberOf) != 1 || reporting.MemberOf[0].Role != "readonly" {
+		t.Errorf("expected role reporting to be a member of readonly, got %v", reporting.MemberOf)
+	}
+	if reporting.Comment == nil || *reporting.Comment != "2022-01-01" {
+		t.Errorf("expected a quoted date to be kept as a string, got %v", reporting.Comment)
+	}
+	if _, exists := config.resolved["users"]["backup_user"]; exists {
+		t.Errorf("expected only users that reference templates to be resolved")
+	}
+}
+
+func TestParseConfigTestdata(t *testing.T) {
+	data, err := os.ReadFile("../testdata/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, []byte("templates:\n  app:\n    auth: password\n")...)
+	config, err := parseConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.UserConfig["backup_user"].Expiry.IsZero() {
+		t.Errorf("expected backup_user to have an expiry")
+	}
+}
+
+func TestResolveTemplatesErrors(t *testing.T) {
+	for _, test := range []struct {
+		yaml     string
+		expected string
+	}{
+		{"users:\n  a:\n    templates: app\n", "users.a: template app does not exist"},
+		{"templates:\n  t: [a]\nusers:\n  a:\n    templates: t\n", "template t should be an object"},
+		{"templates:\n  t:\n    auth: password\nroles:\n  r:\n    templates: t\n",
+			"roles.r: template t sets auth, which cannot be set for roles"},
+		{"templates:\n  t:\n    unknown: 1\nusers:\n  a:\n    templates: t\n",
+			"template t sets unknown, which cannot be set for users"},
+		{"templates:\n  t1:\n    templates: t2\n  t2:\n    templates: [t1]\nusers:\n  a:\n    templates: t1\n",
+			"template t1 references itself (t1 -> t2 -> t1)"},
+		{"templates:\n  t:\n    templates: t\nusers:\n  a:\n    templates: t\n", "template t references itself (t -> t)"},
+		{"users:\n  a:\n    templates: {t: 1}\n", "templates should be a name, or a list of names"},
+	} {
+		_, err := resolveTemplates([]byte(test.yaml))
+		if err == nil {
+			t.Errorf("expected an error for %q", test.yaml)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("expected error %q, got %q", test.expected, err.Error())
+		}
+	}
+}
+
+func TestMergeYamlMaps(t *testing.T) {
+	dst := yamlMap{
+		"auth":     "password",
+		"options":  []interface{}{"LOGIN", "CREATEDB"},
+		"settings": yamlMap{"a": "1", "b": "2"},
+	}
+	src := yamlMap{
+		"options":  []interface{}{"NOLOGIN"},
+		"settings": yamlMap{"b": "3", "c": "4"},
+	}
+	expected := yamlMap{
+		"auth":     "password",
+		"options":  []interface{}{"NOLOGIN"},
+		"settings": yamlMap{"a": "1", "b": "3", "c": "4"},
+	}
+	merged := mergeYamlMaps(dst, src)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	if !reflect.DeepEqual(dst["settings"], yamlMap{"a": "1", "b": "2"}) {
+		t.Errorf("expected dst to be unchanged, got %v", dst)
+	}
+}
+
+func TestRedactPassword(t *testing.T) {
+	for _, test := range []struct {
+		password interface{}
+		expected interface{}
+	}{
+		{"secret", redacted},
+		{generatePassword, generatePassword},
+		{yamlMap{"value": "secret"}, yamlMap{"value": redacted}},
+		{yamlMap{"file": "/etc/secret"}, yamlMap{"file": "/etc/secret"}},
+	} {
+		entry := yamlMap{"password": test.password}
+		result := redactPassword(entry)
+		if !reflect.DeepEqual(result["password"], test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, result["password"])
+		}
+		if !reflect.DeepEqual(entry["password"], test.password) {
+			t.Errorf("expected entry to be unchanged, got %v", entry)
+		}
+	}
+}
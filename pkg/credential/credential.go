@@ -0,0 +1,159 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultExecTimeout = 10 * time.Second
+
+// Credential is a secret which can be set directly, or read from an environment variable, a file, the output of
+// an executable, or HashiCorp Vault. In yaml it can be set as a credential object, or as a plain string (which is
+// the same as only setting value).
+type Credential struct {
+	Value   string        `yaml:"value"`
+	Env     string        `yaml:"env"`
+	File    string        `yaml:"file"`
+	Args    []string      `yaml:"args"`
+	Timeout time.Duration `yaml:"timeout"`
+	Vault   *VaultConfig  `yaml:"vault"`
+	Base64  bool          `yaml:"base64"`
+	// scalar is set when the credential was set as a plain string in yaml
+	scalar bool
+	// cache holds the value once it is retrieved, so that (e.a.) executables only run once
+	cache  string
+	cached bool
+}
+
+// UnmarshalYAML allows a credential to be set as a plain string, or as a credential object
+func (c *Credential) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		c.Value = value
+		c.scalar = true
+		return nil
+	}
+	type plain Credential
+	return unmarshal((*plain)(c))
+}
+
+// IsSet returns true if either a value, an environment variable, a file or vault is set for this credential
+func (c Credential) IsSet() bool {
+	return c.Value != "" || c.Env != "" || c.File != "" || c.Vault != nil
+}
+
+// IsScalar returns true if the credential was set as a plain string in yaml (and not as a credential object)
+func (c Credential) IsScalar() bool {
+	return c.scalar
+}
+
+func isExecutable(filename string) (isExecutable bool, err error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	mode := fi.Mode()
+	return mode.IsRegular() && mode&0111 != 0, nil
+}
+
+func (c Credential) fromExecutable() (value string, err error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	// The intent is to give an option to use a 3rd party tool to retrieve a password.
+	// Or a script to hash / unhash anyway you like
+	// As such running an arbitrary command set as a parameter is sort of the point.
+	// #nosec
+	cmd := exec.CommandContext(ctx, c.File, c.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("executable %s timed out after %s", c.File, timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("executable %s failed: %v (stderr: %s)", c.File, err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (c Credential) fromFile() (value string, err error) {
+	isExec, err := isExecutable(c.File)
+	if err != nil {
+		return "", fmt.Errorf("cannot read credential file: %v", err)
+	}
+	if isExec {
+		return c.fromExecutable()
+	}
+	// The intent is to give an option to retrieve a password from a file.
+	// As such opening a file which name is set by a variable is sort of the point.
+	// #nosec
+	data, err := os.ReadFile(c.File)
+	if err != nil {
+		return "", fmt.Errorf("cannot read credential file: %v", err)
+	}
+	return string(data), nil
+}
+
+func (c Credential) fromEnv() (value string, err error) {
+	value, exists := os.LookupEnv(c.Env)
+	if !exists {
+		return "", fmt.Errorf("environment variable %s is not set", c.Env)
+	}
+	return value, nil
+}
+
+// GetCred returns the value of the credential, from the first source that is set (value, env, file or vault).
+// Trailing newlines are trimmed from env, file and executable values, and base64 values are decoded.
+func (c *Credential) GetCred() (value string, err error) {
+	if c.cached {
+		return c.cache, nil
+	}
+	var source string
+	switch {
+	case c.Value != "":
+		source = "value"
+		value = c.Value
+	case c.Env != "":
+		source = fmt.Sprintf("env %s", c.Env)
+		value, err = c.fromEnv()
+	case c.File != "":
+		source = fmt.Sprintf("file %s", c.File)
+		value, err = c.fromFile()
+	case c.Vault != nil:
+		source = fmt.Sprintf("vault %s", c.Vault.Path)
+		value, err = c.Vault.Read()
+	default:
+		return "", fmt.Errorf("either value, env, file or vault must be set in a credential")
+	}
+	if err != nil {
+		return "", err
+	}
+	if c.Env != "" || c.File != "" {
+		value = strings.TrimRight(value, "\r\n")
+	}
+	if c.Base64 {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("cannot base64 decode credential from %s: %v", source, err)
+		}
+		value = string(data)
+	}
+	if value == "" {
+		return "", fmt.Errorf("credential from %s is empty", source)
+	}
+	c.cache = value
+	c.cached = true
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package credential
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to a file in a temporary directory, and returns its path
+func writeFile(t *testing.T, name string, content string, mode os.FileMode) (path string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets an environment variable for the duration of a test
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+	err := os.Setenv(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Unsetenv(key) })
+}
+
+func assertCred(t *testing.T, c Credential, expected string) {
+	t.Helper()
+	value, err := c.GetCred()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != expected {
+		t.Errorf("expected %q, got %q", expected, value)
+	}
+}
+
+func assertCredError(t *testing.T, c Credential, expected string) {
+	t.Helper()
+	_, err := c.GetCred()
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected an error containing %q, got %v", expected, err)
+	}
+}
+
+func TestValue(t *testing.T) {
+	// values are used as is (including trailing newlines)
+	assertCred(t, Credential{Value: "secret\n"}, "secret\n")
+	assertCredError(t, Credential{}, "either value, env, file or vault must be set")
+}
+
+func TestEnv(t *testing.T) {
+	setenv(t, "PGFGA_TEST_CRED", "secret\r\n")
+	assertCred(t, Credential{Env: "PGFGA_TEST_CRED"}, "secret")
+	assertCredError(t, Credential{Env: "PGFGA_TEST_NOT_SET"}, "environment variable PGFGA_TEST_NOT_SET is not set")
+	setenv(t, "PGFGA_TEST_EMPTY", "")
+	assertCredError(t, Credential{Env: "PGFGA_TEST_EMPTY"}, "is empty")
+}
+
+func TestFile(t *testing.T) {
+	assertCred(t, Credential{File: writeFile(t, "cred", "secret\n\n", 0600)}, "secret")
+	// only trailing newlines are trimmed
+	assertCred(t, Credential{File: writeFile(t, "cred", " sec\nret \n", 0600)}, " sec\nret ")
+	assertCredError(t, Credential{File: filepath.Join(t.TempDir(), "missing")}, "cannot read credential file")
+}
+
+func TestExec(t *testing.T) {
+	script := writeFile(t, "cred.sh", "#!/bin/sh\necho \"$1-$2\"\n", 0700)
+	assertCred(t, Credential{File: script, Args: []string{"a", "b c"}}, "a-b c")
+
+	script = writeFile(t, "fail.sh", "#!/bin/sh\necho 'no access' >&2\nexit 3\n", 0700)
+	assertCredError(t, Credential{File: script}, "stderr: no access")
+
+	script = writeFile(t, "slow.sh", "#!/bin/sh\nexec sleep 5\n", 0700)
+	start := time.Now()
+	assertCredError(t, Credential{File: script, Timeout: 100 * time.Millisecond}, "timed out after 100ms")
+	if time.Since(start) > 4*time.Second {
+		t.Error("executable was not killed after the timeout")
+	}
+}
+
+func TestExecCached(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	script := writeFile(t, "cred.sh", "#!/bin/sh\necho x >> "+counter+"\necho secret\n", 0700)
+	c := &Credential{File: script}
+	for i := 0; i < 2; i++ {
+		value, err := c.GetCred()
+		if err != nil || value != "secret" {
+			t.Fatalf("expected \"secret\", got %q (%v)", value, err)
+		}
+	}
+	data, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(data), "x"); runs != 1 {
+		t.Errorf("expected the executable to run once, got %d", runs)
+	}
+}
+
+func TestBase64(t *testing.T) {
+	assertCred(t, Credential{Value: "c2VjcmV0", Base64: true}, "secret")
+	assertCred(t, Credential{File: writeFile(t, "cred", "c2VjcmV0\n", 0600), Base64: true}, "secret")
+	assertCredError(t, Credential{Value: "not base64!", Base64: true}, "cannot base64 decode credential from value")
+}
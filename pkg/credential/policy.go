@@ -0,0 +1,89 @@
+package credential
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy defines the requirements for cleartext passwords
+type PasswordPolicy struct {
+	MinLength        int    `yaml:"min_length"`
+	MinClasses       int    `yaml:"min_classes"`
+	DenyList         string `yaml:"deny_list"`
+	DisallowUsername bool   `yaml:"disallow_username"`
+	// denied caches the (lowercase) passwords from the deny list
+	denied map[string]bool
+}
+
+// IsSet returns true if the policy has any requirements
+func (pp PasswordPolicy) IsSet() bool {
+	return pp.MinLength > 0 || pp.MinClasses > 0 || pp.DenyList != "" || pp.DisallowUsername
+}
+
+// characterClasses returns the number of character classes (lowercase, uppercase, digits and other) in password
+func characterClasses(password string) (classes int) {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	for _, class := range []bool{lower, upper, digit, other} {
+		if class {
+			classes++
+		}
+	}
+	return classes
+}
+
+func (pp *PasswordPolicy) readDenyList() (err error) {
+	if pp.denied != nil || pp.DenyList == "" {
+		return nil
+	}
+	// #nosec
+	f, err := os.Open(pp.DenyList)
+	if err != nil {
+		return fmt.Errorf("cannot read password_policy deny_list: %v", err)
+	}
+	defer f.Close()
+	pp.denied = make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			pp.denied[strings.ToLower(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Check returns all requirements of the policy that password (for userName) violates
+func (pp *PasswordPolicy) Check(userName string, password string) (violations []string, err error) {
+	if pp.MinLength > 0 && len([]rune(password)) < pp.MinLength {
+		violations = append(violations, fmt.Sprintf("shorter than %d characters", pp.MinLength))
+	}
+	if classes := characterClasses(password); classes < pp.MinClasses {
+		violations = append(violations, fmt.Sprintf("%d character classes, %d required", classes, pp.MinClasses))
+	}
+	if pp.DisallowUsername && strings.Contains(strings.ToLower(password), strings.ToLower(userName)) {
+		violations = append(violations, "contains the username")
+	}
+	err = pp.readDenyList()
+	if err != nil {
+		return nil, err
+	}
+	if pp.denied[strings.ToLower(password)] {
+		violations = append(violations, "in the deny list")
+	}
+	return violations, nil
+}
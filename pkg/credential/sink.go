@@ -0,0 +1,206 @@
+package credential
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultPasswordLength = 32
+	defaultSinkKey        = "password"
+	sinkUsernameKey       = "username"
+	k8sGeneratedKey       = "pgfga/generated"
+	passwordCharacters    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Sink is a destination where generated passwords are published, so that applications can pick them up
+type Sink struct {
+	File string `yaml:"file"`
+	// UsernameFile is written with the name of the user next to File (e.a. for dual role password rotation)
+	UsernameFile string         `yaml:"username_file"`
+	Kubernetes   *K8sSecretSink `yaml:"kubernetes"`
+	Vault        *VaultConfig   `yaml:"vault"`
+}
+
+// K8sSecretSink writes a Kubernetes Secret manifest to a file (which can be applied with kubectl)
+type K8sSecretSink struct {
+	File      string `yaml:"file"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Key       string `yaml:"key"`
+}
+
+type k8sSecret struct {
+	ApiVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace,omitempty"`
+		Annotations map[string]string `yaml:"annotations,omitempty"`
+	} `yaml:"metadata"`
+	Type string            `yaml:"type"`
+	Data map[string]string `yaml:"data"`
+}
+
+// GeneratePassword returns a random password of length characters (letters and digits)
+func GeneratePassword(length int) (password string, err error) {
+	if length <= 0 {
+		length = defaultPasswordLength
+	}
+	max := big.NewInt(int64(len(passwordCharacters)))
+	chars := make([]byte, length)
+	for i := range chars {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		chars[i] = passwordCharacters[n.Int64()]
+	}
+	return string(chars), nil
+}
+
+// IsSet returns true if either a file, a kubernetes secret or vault is set for this sink
+func (s Sink) IsSet() bool {
+	return s.File != "" || s.Kubernetes != nil || s.Vault != nil
+}
+
+func (s Sink) vault() VaultConfig {
+	vc := *s.Vault
+	if vc.Field == "" {
+		vc.Field = defaultSinkKey
+	}
+	return vc
+}
+
+func (ks K8sSecretSink) key() string {
+	if ks.Key == "" {
+		return defaultSinkKey
+	}
+	return ks.Key
+}
+
+// Read returns the password that was published to the sink before, and when it was generated.
+// When nothing was published yet, an empty password is returned.
+func (s Sink) Read() (password string, generated time.Time, err error) {
+	switch {
+	case s.File != "":
+		return readSinkFile(s.File)
+	case s.Kubernetes != nil:
+		return s.Kubernetes.read()
+	case s.Vault != nil:
+		vc := s.vault()
+		secret, err := vc.secret(true)
+		if err != nil {
+			return "", generated, err
+		}
+		password, _ = secret.Data[vc.Field].(string)
+		return password, secret.Created, nil
+	default:
+		return "", generated, fmt.Errorf("either file, kubernetes or vault must be set in a password_sink")
+	}
+}
+
+// Write publishes a (generated) password for loginName to the sink of user userName. loginName differs from userName
+// for dual roles (e.a. app_a for user app), and is published next to the password, while the sink itself (e.a. the
+// name of a kubernetes secret) stays the same for every login role.
+func (s Sink) Write(userName string, loginName string, password string) (err error) {
+	switch {
+	case s.File != "":
+		if s.UsernameFile != "" {
+			err = writeSinkFile(s.UsernameFile, []byte(loginName))
+			if err != nil {
+				return err
+			}
+		}
+		return writeSinkFile(s.File, []byte(password))
+	case s.Kubernetes != nil:
+		return s.Kubernetes.write(userName, loginName, password)
+	case s.Vault != nil:
+		vc := s.vault()
+		return vc.Write(map[string]string{vc.Field: password, sinkUsernameKey: loginName})
+	default:
+		return fmt.Errorf("either file, kubernetes or vault must be set in a password_sink")
+	}
+}
+
+func readSinkFile(fileName string) (password string, generated time.Time, err error) {
+	// #nosec
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return "", generated, nil
+	} else if err != nil {
+		return "", generated, err
+	}
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return "", generated, err
+	}
+	return string(data), fi.ModTime(), nil
+}
+
+// writeSinkFile writes data to a temporary file (0600) and renames it, so that readers never see a partial file
+func writeSinkFile(fileName string, data []byte) (err error) {
+	tmpFile := filepath.Join(filepath.Dir(fileName), "."+filepath.Base(fileName)+".tmp")
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, fileName)
+}
+
+func (ks K8sSecretSink) read() (password string, generated time.Time, err error) {
+	data, _, err := readSinkFile(ks.File)
+	if err != nil || data == "" {
+		return "", generated, err
+	}
+	var secret k8sSecret
+	err = yaml.Unmarshal([]byte(data), &secret)
+	if err != nil {
+		return "", generated, fmt.Errorf("could not parse kubernetes secret %s: %v", ks.File, err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(secret.Data[ks.key()])
+	if err != nil {
+		return "", generated, fmt.Errorf("could not decode %s from kubernetes secret %s: %v", ks.key(), ks.File, err)
+	}
+	if value, exists := secret.Metadata.Annotations[k8sGeneratedKey]; exists {
+		generated, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", generated, fmt.Errorf("invalid %s annotation in kubernetes secret %s: %v", k8sGeneratedKey,
+				ks.File, err)
+		}
+	}
+	return string(decoded), generated, nil
+}
+
+// write writes the secret (named after userName, unless name is set), with the password for loginName
+func (ks K8sSecretSink) write(userName string, loginName string, password string) (err error) {
+	if ks.File == "" {
+		return fmt.Errorf("file must be set for a kubernetes password_sink")
+	}
+	var secret k8sSecret
+	secret.ApiVersion = "v1"
+	secret.Kind = "Secret"
+	secret.Type = "Opaque"
+	secret.Metadata.Name = ks.Name
+	if secret.Metadata.Name == "" {
+		secret.Metadata.Name = userName
+	}
+	secret.Metadata.Namespace = ks.Namespace
+	secret.Metadata.Annotations = map[string]string{k8sGeneratedKey: time.Now().UTC().Format(time.RFC3339)}
+	secret.Data = map[string]string{
+		sinkUsernameKey: base64.StdEncoding.EncodeToString([]byte(loginName)),
+		ks.key():        base64.StdEncoding.EncodeToString([]byte(password)),
+	}
+	data, err := yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	return writeSinkFile(ks.File, data)
+}
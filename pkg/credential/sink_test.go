@@ -0,0 +1,75 @@
+package credential
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func readK8sSecret(t *testing.T, path string) (secret k8sSecret) {
+	t.Helper()
+	// #nosec
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = yaml.Unmarshal(data, &secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestK8sSinkDualRoles(t *testing.T) {
+	sink := Sink{Kubernetes: &K8sSecretSink{File: filepath.Join(t.TempDir(), "secret.yaml"), Namespace: "apps"}}
+	for _, loginName := range []string{"app_a", "app_b"} {
+		err := sink.Write("app", loginName, "pw_"+loginName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret := readK8sSecret(t, sink.Kubernetes.File)
+		if secret.Metadata.Name != "app" {
+			t.Errorf("expected the secret to be named after user app, got %s", secret.Metadata.Name)
+		}
+		username, _ := base64.StdEncoding.DecodeString(secret.Data[sinkUsernameKey])
+		if string(username) != loginName {
+			t.Errorf("expected username %s, got %s", loginName, username)
+		}
+		password, generated, err := sink.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password != "pw_"+loginName || generated.IsZero() {
+			t.Errorf("expected password pw_%s with a generated time, got %s (%s)", loginName, password, generated)
+		}
+	}
+	sink.Kubernetes.Name = "app-credentials"
+	err := sink.Write("app", "app_a", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret := readK8sSecret(t, sink.Kubernetes.File); secret.Metadata.Name != "app-credentials" {
+		t.Errorf("expected the configured name app-credentials, got %s", secret.Metadata.Name)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink := Sink{File: filepath.Join(dir, "password"), UsernameFile: filepath.Join(dir, "username")}
+	password, _, err := sink.Read()
+	if err != nil || password != "" {
+		t.Fatalf("expected an empty password before anything was written, got %q (%v)", password, err)
+	}
+	err = sink.Write("app", "app_b", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCred(t, Credential{File: sink.UsernameFile}, "app_b")
+	password, _, err = sink.Read()
+	if err != nil || password != "secret" {
+		t.Errorf("expected password secret, got %q (%v)", password, err)
+	}
+}
@@ -0,0 +1,370 @@
+package credential
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultVaultMount        = "secret"
+	defaultVaultApproleMount = "approle"
+	defaultVaultTimeout      = 30 * time.Second
+)
+
+// VaultConfig configures reading a field from a HashiCorp Vault KV (version 2) secret
+type VaultConfig struct {
+	Address      string      `yaml:"address"`
+	Mount        string      `yaml:"mount"`
+	Path         string      `yaml:"path"`
+	Field        string      `yaml:"field"`
+	Namespace    string      `yaml:"namespace"`
+	CAFile       string      `yaml:"ca_file"`
+	TokenFile    string      `yaml:"token_file"`
+	RoleId       string      `yaml:"role_id"`
+	SecretId     *Credential `yaml:"secret_id"`
+	ApproleMount string      `yaml:"approle_mount"`
+	// cache is used instead of defaultVaultCache when set
+	cache *vaultCache
+}
+
+var errVaultNotFound = errors.New("not found")
+
+// vaultCache holds the secrets read from (or written to) vault, and the tokens retrieved with AppRole logins.
+// All credentials share defaultVaultCache (unless cache is set on the VaultConfig), so that a secret with multiple
+// fields is only read once every run.
+type vaultCache struct {
+	mutex   sync.Mutex
+	secrets map[string]*vaultSecret
+	tokens  map[string]string
+}
+
+var defaultVaultCache = newVaultCache()
+
+func newVaultCache() (c *vaultCache) {
+	return &vaultCache{
+		secrets: make(map[string]*vaultSecret),
+		tokens:  make(map[string]string),
+	}
+}
+
+func (c *vaultCache) getSecret(key string) (secret *vaultSecret, exists bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	secret, exists = c.secrets[key]
+	return secret, exists
+}
+
+func (c *vaultCache) setSecret(key string, secret *vaultSecret) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.secrets[key] = secret
+}
+
+func (c *vaultCache) getToken(key string) (token string, exists bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	token, exists = c.tokens[key]
+	return token, exists
+}
+
+func (c *vaultCache) setToken(key string, token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens[key] = token
+}
+
+type vaultSecret struct {
+	Data    map[string]interface{}
+	Created time.Time
+}
+
+type vaultKvResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			CreatedTime time.Time `json:"created_time"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type vaultKvWriteResponse struct {
+	Data struct {
+		CreatedTime time.Time `json:"created_time"`
+	} `json:"data"`
+}
+
+type vaultLoginResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+type vaultErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+func (vc VaultConfig) address() string {
+	address := vc.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	return strings.TrimSuffix(address, "/")
+}
+
+func (vc VaultConfig) mount() string {
+	if vc.Mount == "" {
+		return defaultVaultMount
+	}
+	return strings.Trim(vc.Mount, "/")
+}
+
+func (vc VaultConfig) dataUrl() string {
+	return fmt.Sprintf("%s/v1/%s/data/%s", vc.address(), vc.mount(), strings.Trim(vc.Path, "/"))
+}
+
+func (vc VaultConfig) getCache() *vaultCache {
+	if vc.cache != nil {
+		return vc.cache
+	}
+	return defaultVaultCache
+}
+
+// secretKey identifies a secret in the cache (the same path can exist in multiple namespaces)
+func (vc VaultConfig) secretKey() string {
+	return vc.Namespace + "|" + vc.dataUrl()
+}
+
+func (vc VaultConfig) client() (client *http.Client, err error) {
+	client = &http.Client{Timeout: defaultVaultTimeout}
+	if vc.CAFile == "" {
+		return client, nil
+	}
+	// The intent is to read a CA bundle from a configured file.
+	// #nosec
+	caPem, err := os.ReadFile(vc.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no valid certificates found in vault ca_file %s", vc.CAFile)
+	}
+	client.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}
+	return client, nil
+}
+
+// request sends a request to vault, and decodes the json response into v
+func (vc VaultConfig) request(method string, url string, token string, body interface{}, v interface{}) (err error) {
+	client, err := vc.client()
+	if err != nil {
+		return err
+	}
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vc.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.Namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("vault %s %s: %w", method, url, errVaultNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr vaultErrorResponse
+		if json.Unmarshal(respBody, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("vault %s %s returned %s: %s", method, url, resp.Status,
+				strings.Join(vaultErr.Errors, ", "))
+		}
+		return fmt.Errorf("vault %s %s returned %s", method, url, resp.Status)
+	}
+	if v == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, v)
+}
+
+// token returns the vault token from token_file, an AppRole login, VAULT_TOKEN or ~/.vault-token (in that order)
+func (vc VaultConfig) token() (token string, err error) {
+	if vc.TokenFile != "" {
+		// #nosec
+		data, err := os.ReadFile(vc.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read vault token_file: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if vc.RoleId != "" {
+		return vc.approleLogin()
+	}
+	if token = os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		// #nosec
+		data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+		if err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", fmt.Errorf("no vault token (set token_file, role_id and secret_id, VAULT_TOKEN or ~/.vault-token)")
+}
+
+func (vc VaultConfig) approleLogin() (token string, err error) {
+	cacheKey := strings.Join([]string{vc.address(), vc.Namespace, vc.RoleId}, "|")
+	if token, exists := vc.getCache().getToken(cacheKey); exists {
+		return token, nil
+	}
+	if vc.SecretId == nil {
+		return "", fmt.Errorf("secret_id must be set for vault AppRole login")
+	}
+	secretId, err := vc.SecretId.GetCred()
+	if err != nil {
+		return "", fmt.Errorf("could not get vault secret_id: %v", err)
+	}
+	mount := vc.ApproleMount
+	if mount == "" {
+		mount = defaultVaultApproleMount
+	}
+	var login vaultLoginResponse
+	body := map[string]string{"role_id": vc.RoleId, "secret_id": secretId}
+	err = vc.request(http.MethodPost, fmt.Sprintf("%s/v1/auth/%s/login", vc.address(), strings.Trim(mount, "/")),
+		"", body, &login)
+	if err != nil {
+		return "", err
+	}
+	if login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault AppRole login returned no token")
+	}
+	vc.getCache().setToken(cacheKey, login.Auth.ClientToken)
+	return login.Auth.ClientToken, nil
+}
+
+func (vc VaultConfig) validate() (err error) {
+	if vc.address() == "" {
+		return fmt.Errorf("vault address must be set (or VAULT_ADDR)")
+	}
+	if vc.Path == "" {
+		return fmt.Errorf("vault path must be set")
+	}
+	return nil
+}
+
+// secret returns the secret from vault (or the cache). When missing is true, a secret that does not exist (yet) is
+// returned as an empty secret instead of an error.
+func (vc VaultConfig) secret(missing bool) (secret *vaultSecret, err error) {
+	err = vc.validate()
+	if err != nil {
+		return nil, err
+	}
+	if vc.Field == "" {
+		return nil, fmt.Errorf("vault field must be set")
+	}
+	cache := vc.getCache()
+	if secret, exists := cache.getSecret(vc.secretKey()); exists {
+		return secret, nil
+	}
+	token, err := vc.token()
+	if err != nil {
+		return nil, err
+	}
+	var kv vaultKvResponse
+	err = vc.request(http.MethodGet, vc.dataUrl(), token, nil, &kv)
+	if err != nil {
+		if missing && errors.Is(err, errVaultNotFound) {
+			secret = &vaultSecret{Data: make(map[string]interface{})}
+			cache.setSecret(vc.secretKey(), secret)
+			return secret, nil
+		}
+		return nil, err
+	}
+	secret = &vaultSecret{Data: kv.Data.Data, Created: kv.Data.Metadata.CreatedTime}
+	if secret.Data == nil {
+		secret.Data = make(map[string]interface{})
+	}
+	cache.setSecret(vc.secretKey(), secret)
+	return secret, nil
+}
+
+// Write sets fields of the secret in vault, as a new version of the secret (other fields are kept)
+func (vc VaultConfig) Write(fields map[string]string) (err error) {
+	secret, err := vc.secret(true)
+	if err != nil {
+		return err
+	}
+	token, err := vc.token()
+	if err != nil {
+		return err
+	}
+	data := make(map[string]interface{})
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+	var kv vaultKvWriteResponse
+	err = vc.request(http.MethodPost, vc.dataUrl(), token, map[string]interface{}{"data": data}, &kv)
+	if err != nil {
+		return err
+	}
+	vc.getCache().setSecret(vc.secretKey(), &vaultSecret{Data: data, Created: kv.Data.CreatedTime})
+	return nil
+}
+
+// Read returns the field of the secret in vault. Secrets are cached, so they are read only once for every run.
+func (vc VaultConfig) Read() (value string, err error) {
+	secret, err := vc.secret(false)
+	if err != nil {
+		return "", err
+	}
+	field, exists := secret.Data[vc.Field]
+	if !exists {
+		return "", fmt.Errorf("vault secret %s has no field %s", vc.Path, vc.Field)
+	}
+	switch v := field.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,187 @@
+package credential
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vaultStub is a minimal HashiCorp Vault KV v2 (and AppRole login) api
+type vaultStub struct {
+	mutex sync.Mutex
+	// secrets holds the data of all secrets by namespace and path (e.a. ns1|/v1/secret/data/app)
+	secrets map[string]map[string]interface{}
+	token   string
+	roleId  string
+	// requests counts the requests by method and path
+	requests map[string]int
+}
+
+func newVaultStub(t *testing.T) (vs *vaultStub, server *httptest.Server) {
+	vs = &vaultStub{
+		secrets:  make(map[string]map[string]interface{}),
+		token:    "root",
+		requests: make(map[string]int),
+	}
+	server = httptest.NewServer(vs)
+	t.Cleanup(server.Close)
+	return vs, server
+}
+
+func (vs *vaultStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.requests[r.Method+" "+r.URL.Path]++
+	if strings.HasPrefix(r.URL.Path, "/v1/auth/") {
+		var login map[string]string
+		if json.NewDecoder(r.Body).Decode(&login) != nil || login["role_id"] != vs.roleId ||
+			login["secret_id"] != "s3cr3t" {
+			vs.error(w, http.StatusBadRequest, "invalid role or secret id")
+			return
+		}
+		vs.write(w, map[string]interface{}{"auth": map[string]string{"client_token": vs.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != vs.token {
+		vs.error(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	key := r.Header.Get("X-Vault-Namespace") + "|" + r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		data, exists := vs.secrets[key]
+		if !exists {
+			vs.error(w, http.StatusNotFound, "")
+			return
+		}
+		vs.write(w, map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]string{"created_time": "2026-01-02T03:04:05Z"},
+		}})
+	case http.MethodPost:
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			vs.error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		vs.secrets[key] = body.Data
+		vs.write(w, map[string]interface{}{"data": map[string]string{"created_time": "2026-02-03T04:05:06Z"}})
+	}
+}
+
+func (vs *vaultStub) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (vs *vaultStub) error(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	var errs []string
+	if message != "" {
+		errs = append(errs, message)
+	}
+	vs.write(w, vaultErrorResponse{Errors: errs})
+}
+
+func (vs *vaultStub) count(request string) int {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	return vs.requests[request]
+}
+
+func TestVaultRead(t *testing.T) {
+	vs, server := newVaultStub(t)
+	vs.secrets["|/v1/secret/data/app"] = map[string]interface{}{"password": "pw", "port": 5432}
+	tokenFile := writeFile(t, "token", "root\n", 0600)
+	cache := newVaultCache()
+	vc := VaultConfig{Address: server.URL + "/", Path: "/app/", Field: "password", TokenFile: tokenFile, cache: cache}
+
+	assertCred(t, Credential{Vault: &vc}, "pw")
+	port := vc
+	port.Field = "port"
+	assertCred(t, Credential{Vault: &port}, "5432")
+	if count := vs.count("GET /v1/secret/data/app"); count != 1 {
+		t.Errorf("expected the secret to be read once, got %d", count)
+	}
+
+	missing := vc
+	missing.Field = "missing"
+	assertCredError(t, Credential{Vault: &missing}, "has no field missing")
+	missing = vc
+	missing.Path = "other"
+	assertCredError(t, Credential{Vault: &missing}, "not found")
+	missing.TokenFile = writeFile(t, "token", "wrong", 0600)
+	assertCredError(t, Credential{Vault: &missing}, "permission denied")
+}
+
+func TestVaultNamespaces(t *testing.T) {
+	vs, server := newVaultStub(t)
+	vs.secrets["ns1|/v1/secret/data/app"] = map[string]interface{}{"password": "one"}
+	vs.secrets["ns2|/v1/secret/data/app"] = map[string]interface{}{"password": "two"}
+	tokenFile := writeFile(t, "token", "root", 0600)
+	cache := newVaultCache()
+	for _, ns := range []string{"ns1", "ns2"} {
+		vc := VaultConfig{Address: server.URL, Namespace: ns, Path: "app", Field: "password", TokenFile: tokenFile,
+			cache: cache}
+		expected := map[string]string{"ns1": "one", "ns2": "two"}[ns]
+		assertCred(t, Credential{Vault: &vc}, expected)
+	}
+}
+
+func TestVaultApprole(t *testing.T) {
+	vs, server := newVaultStub(t)
+	vs.roleId = "pgfga"
+	vs.secrets["|/v1/kv/data/app"] = map[string]interface{}{"password": "pw"}
+	cache := newVaultCache()
+	vc := VaultConfig{Address: server.URL, Mount: "kv", Path: "app", Field: "password", RoleId: "pgfga",
+		SecretId: &Credential{Value: "s3cr3t"}, cache: cache}
+	assertCred(t, Credential{Vault: &vc}, "pw")
+	other := vc
+	other.Path = "other"
+	assertCredError(t, Credential{Vault: &other}, "not found")
+	if count := vs.count("POST /v1/auth/approle/login"); count != 1 {
+		t.Errorf("expected one AppRole login, got %d", count)
+	}
+
+	wrong := vc
+	wrong.RoleId = "wrong"
+	wrong.cache = newVaultCache()
+	assertCredError(t, Credential{Vault: &wrong}, "invalid role or secret id")
+}
+
+func TestVaultWrite(t *testing.T) {
+	vs, server := newVaultStub(t)
+	vs.secrets["|/v1/secret/data/app"] = map[string]interface{}{"other": "kept"}
+	tokenFile := writeFile(t, "token", "root", 0600)
+	vc := VaultConfig{Address: server.URL, Path: "app", Field: "password", TokenFile: tokenFile,
+		cache: newVaultCache()}
+	err := vc.Write(map[string]string{"password": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := vs.secrets["|/v1/secret/data/app"]; data["password"] != "new" || data["other"] != "kept" {
+		t.Errorf("expected password to be written and other to be kept, got %v", data)
+	}
+	secret, err := vc.secret(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secret.Created.Equal(time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)) {
+		t.Errorf("expected the created time of the new version, got %s", secret.Created)
+	}
+
+	// secrets that do not exist yet are created
+	vc.Path = "new"
+	err = vc.Write(map[string]string{"password": "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.cache = newVaultCache()
+	assertCred(t, Credential{Vault: &vc}, "pw")
+}
@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileConfig configures a static file with groups and their members.
+// yaml and json files hold a map of group names to lists of members, csv files hold group,member lines.
+type FileConfig struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format"`
+}
+
+type FileSource struct {
+	config FileConfig
+	groups GroupMembers
+}
+
+func NewFileSource(config FileConfig) (fs *FileSource) {
+	return &FileSource{
+		config: config,
+	}
+}
+
+func (fs *FileSource) format() string {
+	if fs.config.Format != "" {
+		return strings.ToLower(fs.config.Format)
+	}
+	switch strings.ToLower(filepath.Ext(fs.config.Path)) {
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	}
+	return "yaml"
+}
+
+func (fs *FileSource) load() (err error) {
+	if fs.groups != nil {
+		return nil
+	}
+	if fs.config.Path == "" {
+		return fmt.Errorf("file_groups.path must be set for file-group users")
+	}
+	// The intent is to read groups from a configured file.
+	// #nosec
+	data, err := os.ReadFile(fs.config.Path)
+	if err != nil {
+		return err
+	}
+	groups := make(GroupMembers)
+	switch fs.format() {
+	case "yaml":
+		err = yaml.Unmarshal(data, &groups)
+	case "json":
+		err = json.Unmarshal(data, &groups)
+	case "csv":
+		var records [][]string
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.Comment = '#'
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		records, err = reader.ReadAll()
+		for _, record := range records {
+			groups[record[0]] = append(groups[record[0]], record[1])
+		}
+	default:
+		return fmt.Errorf("invalid format %s for %s (should be yaml, json or csv)", fs.config.Format, fs.config.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %v", fs.config.Path, err)
+	}
+	fs.groups = groups
+	return nil
+}
+
+func (fs *FileSource) GetMembers(group string, filter string) (baseGroup *ldap.Member, err error) {
+	err = fs.load()
+	if err != nil {
+		return nil, err
+	}
+	return fs.groups.Tree(group)
+}
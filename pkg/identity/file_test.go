@@ -0,0 +1,34 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+)
+
+func TestFileSource(t *testing.T) {
+	for _, path := range []string{"testdata/groups.yaml", "testdata/groups.csv"} {
+		fs := NewFileSource(FileConfig{Path: path})
+		baseGroup, err := fs.GetMembers("dba", "")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		assertMemberships(t, baseGroup, "alice>dba", "oncall>dba", "bob>oncall")
+		for _, ms := range baseGroup.MembershipTree() {
+			if ms.Member.Name() == "oncall" && ms.Member.GetMType() != ldap.GroupMType {
+				t.Errorf("%s: expected oncall to be a group", path)
+			}
+		}
+		_, err = fs.GetMembers("missing", "")
+		if err == nil {
+			t.Errorf("%s: expected an error for a group that does not exist", path)
+		}
+	}
+}
+
+func TestFileSourceFormat(t *testing.T) {
+	fs := NewFileSource(FileConfig{Path: "testdata/groups.csv", Format: "xml"})
+	if _, err := fs.GetMembers("dba", ""); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+}
@@ -0,0 +1,162 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultHttpTimeout = 30 * time.Second
+
+// HttpConfig configures a http endpoint serving groups in the SCIM /Groups json format
+type HttpConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type HttpSource struct {
+	config HttpConfig
+	client *http.Client
+	// headers are added to every request (next to the configured headers)
+	headers map[string]string
+	// userName resolves the name of a user that is a member of a group, or returns "" to skip the user
+	userName func(m scimMember) (name string, err error)
+}
+
+type scimListResponse struct {
+	TotalResults int         `json:"totalResults"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	StartIndex   int         `json:"startIndex"`
+	Resources    []scimGroup `json:"Resources"`
+}
+
+type scimGroup struct {
+	Id          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display"`
+	Type    string `json:"type"`
+}
+
+func (sm scimMember) isGroup() bool {
+	return strings.EqualFold(sm.Type, "group")
+}
+
+func NewHttpSource(config HttpConfig) (hs *HttpSource) {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHttpTimeout
+	}
+	return &HttpSource{
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout},
+		headers:  make(map[string]string),
+		userName: displayName,
+	}
+}
+
+// displayName returns the display of a member (or the value when display is not set)
+func displayName(m scimMember) (name string, err error) {
+	if m.Display != "" {
+		return m.Display, nil
+	}
+	return m.Value, nil
+}
+
+// get retrieves a path (relative to the configured url) and decodes the json response into v
+func (hs *HttpSource) get(path string, query url.Values, v interface{}) (err error) {
+	if hs.config.URL == "" {
+		return fmt.Errorf("url must be set for a http group source")
+	}
+	u := strings.TrimSuffix(hs.config.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/scim+json, application/json")
+	for key, value := range hs.config.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range hs.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("GET %s returned invalid json: %v", u, err)
+	}
+	return nil
+}
+
+// getGroups retrieves the group with displayName group (or id, when byId is set) and all nested groups
+func (hs *HttpSource) getGroups(group string, groups GroupMembers, byId bool) (name string, err error) {
+	var g scimGroup
+	if byId {
+		err = hs.get("/Groups/"+url.PathEscape(group), nil, &g)
+	} else {
+		var list scimListResponse
+		query := url.Values{"filter": {fmt.Sprintf("displayName eq \"%s\"", strings.Replace(group, "\"", "\\\"", -1))}}
+		err = hs.get("/Groups", query, &list)
+		if err == nil && len(list.Resources) != 1 {
+			err = fmt.Errorf("expected 1 group with displayName %s, got %d", group, len(list.Resources))
+		}
+		if err == nil {
+			g = list.Resources[0]
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, exists := groups[g.DisplayName]; exists {
+		return g.DisplayName, nil
+	}
+	groups[g.DisplayName] = []string{}
+	for _, m := range g.Members {
+		var memberName string
+		if m.isGroup() {
+			memberName, err = hs.getGroups(m.Value, groups, true)
+		} else {
+			memberName, err = hs.userName(m)
+		}
+		if err != nil {
+			return "", err
+		}
+		if memberName == "" {
+			continue
+		}
+		groups[g.DisplayName] = append(groups[g.DisplayName], memberName)
+	}
+	return g.DisplayName, nil
+}
+
+func (hs *HttpSource) GetMembers(group string, filter string) (baseGroup *ldap.Member, err error) {
+	groups := make(GroupMembers)
+	name, err := hs.getGroups(group, groups, false)
+	if err != nil {
+		return nil, err
+	}
+	return groups.Tree(name)
+}
@@ -0,0 +1,73 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newScimStub returns a server that serves the responses by path (and filter), and requires headers to be set
+func newScimStub(t *testing.T, responses map[string]interface{}, headers map[string]string) (
+	server *httptest.Server) {
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range headers {
+			if r.Header.Get(key) != value {
+				http.Error(w, "missing header "+key, http.StatusUnauthorized)
+				return
+			}
+		}
+		key := r.URL.Path
+		if filter := r.URL.Query().Get("filter"); filter != "" {
+			key += "?" + filter
+		}
+		response, exists := responses[key]
+		if !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/scim+json")
+		err := json.NewEncoder(w).Encode(response)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// scimGroups holds the dba group (with a nested oncall group)
+var scimGroups = map[string]interface{}{
+	`/Groups?displayName eq "dba"`: scimListResponse{TotalResults: 1, Resources: []scimGroup{{
+		Id:          "1",
+		DisplayName: "dba",
+		Members: []scimMember{
+			{Value: "u1", Display: "alice", Type: "User"},
+			{Value: "2", Display: "oncall", Type: "Group"},
+		},
+	}}},
+	"/Groups/2": scimGroup{
+		Id:          "2",
+		DisplayName: "oncall",
+		Members:     []scimMember{{Value: "u2", Display: "bob", Type: "User"}},
+	},
+}
+
+func TestHttpSource(t *testing.T) {
+	server := newScimStub(t, scimGroups, map[string]string{"X-Test": "yes"})
+	hs := NewHttpSource(HttpConfig{URL: server.URL + "/", Headers: map[string]string{"X-Test": "yes"}})
+	baseGroup, err := hs.GetMembers("dba", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMemberships(t, baseGroup, "alice>dba", "oncall>dba", "bob>oncall")
+
+	if _, err = hs.GetMembers("missing", ""); err == nil {
+		t.Error("expected an error for a group that does not exist")
+	}
+
+	hs = NewHttpSource(HttpConfig{URL: server.URL})
+	if _, err = hs.GetMembers("dba", ""); err == nil {
+		t.Error("expected an error without the configured headers")
+	}
+}
@@ -0,0 +1,11 @@
+package identity
+
+import (
+	"go.uber.org/zap"
+)
+
+var log *zap.SugaredLogger
+
+func Initialize(sugar *zap.SugaredLogger) {
+	log = sugar
+}
@@ -0,0 +1,96 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	scimUserName    = "userName"
+	scimDisplayName = "displayName"
+)
+
+// ScimConfig configures a SCIM 2.0 api (e.a. Azure AD or Okta) as source for groups and their members
+type ScimConfig struct {
+	URL           string                `yaml:"url"`
+	Token         credential.Credential `yaml:"token"`
+	UserAttribute string                `yaml:"user_attribute"`
+	Timeout       time.Duration         `yaml:"timeout"`
+}
+
+type ScimSource struct {
+	*HttpSource
+	config ScimConfig
+	// users caches the role names of users by their id
+	users map[string]string
+}
+
+type scimUser struct {
+	Id          string `json:"id"`
+	UserName    string `json:"userName"`
+	DisplayName string `json:"displayName"`
+	Active      *bool  `json:"active"`
+}
+
+func NewScimSource(config ScimConfig) (ss *ScimSource) {
+	if config.UserAttribute == "" {
+		config.UserAttribute = scimUserName
+	}
+	ss = &ScimSource{
+		HttpSource: NewHttpSource(HttpConfig{
+			URL:     config.URL,
+			Timeout: config.Timeout,
+		}),
+		config: config,
+		users:  make(map[string]string),
+	}
+	ss.HttpSource.userName = ss.userName
+	return ss
+}
+
+// userName retrieves a user from the /Users endpoint and returns the role name for it.
+// Inactive users are skipped (an empty name is returned).
+func (ss *ScimSource) userName(m scimMember) (name string, err error) {
+	if name, exists := ss.users[m.Value]; exists {
+		return name, nil
+	}
+	var u scimUser
+	err = ss.get("/Users/"+url.PathEscape(m.Value), nil, &u)
+	if err != nil {
+		return "", err
+	}
+	if u.Active != nil && !*u.Active {
+		log.Infof("skipping inactive scim user %s", u.UserName)
+		ss.users[m.Value] = ""
+		return "", nil
+	}
+	switch ss.config.UserAttribute {
+	case scimUserName:
+		name = u.UserName
+	case scimDisplayName:
+		name = u.DisplayName
+	default:
+		return "", fmt.Errorf("invalid user_attribute %s (should be %s or %s)", ss.config.UserAttribute,
+			scimUserName, scimDisplayName)
+	}
+	if name == "" {
+		return "", fmt.Errorf("scim user %s has no %s", m.Value, ss.config.UserAttribute)
+	}
+	ss.users[m.Value] = name
+	return name, nil
+}
+
+func (ss *ScimSource) GetMembers(group string, filter string) (baseGroup *ldap.Member, err error) {
+	if _, exists := ss.headers["Authorization"]; !exists {
+		token, err := ss.config.Token.GetCred()
+		if err != nil {
+			return nil, fmt.Errorf("could not get scim token: %v", err)
+		}
+		ss.headers["Authorization"] = "Bearer " + strings.TrimSpace(token)
+	}
+	return ss.HttpSource.GetMembers(group, filter)
+}
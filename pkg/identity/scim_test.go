@@ -0,0 +1,61 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+)
+
+func scimUsers() (responses map[string]interface{}) {
+	inactive := false
+	responses = map[string]interface{}{
+		"/Users/u1": scimUser{Id: "u1", UserName: "alice@example.com", DisplayName: "alice"},
+		"/Users/u2": scimUser{Id: "u2", UserName: "bob@example.com", DisplayName: "bob"},
+		"/Users/u3": scimUser{Id: "u3", UserName: "carol@example.com", Active: &inactive},
+	}
+	for key, value := range scimGroups {
+		responses[key] = value
+	}
+	return responses
+}
+
+func TestScimSource(t *testing.T) {
+	responses := scimUsers()
+	dba := responses[`/Groups?displayName eq "dba"`].(scimListResponse).Resources[0]
+	dba.Members = append(append([]scimMember{}, dba.Members...), scimMember{Value: "u3", Type: "User"})
+	responses[`/Groups?displayName eq "dba"`] = scimListResponse{TotalResults: 1, Resources: []scimGroup{dba}}
+	server := newScimStub(t, responses, map[string]string{"Authorization": "Bearer secret"})
+
+	ss := NewScimSource(ScimConfig{URL: server.URL, Token: credential.Credential{Value: "secret\n"}})
+	baseGroup, err := ss.GetMembers("dba", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inactive users (carol) are skipped
+	assertMemberships(t, baseGroup, "alice@example.com>dba", "oncall>dba", "bob@example.com>oncall")
+
+	ss = NewScimSource(ScimConfig{URL: server.URL, Token: credential.Credential{Value: "secret"},
+		UserAttribute: scimDisplayName})
+	baseGroup, err = ss.GetMembers("dba", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMemberships(t, baseGroup, "alice>dba", "oncall>dba", "bob>oncall")
+
+	ss = NewScimSource(ScimConfig{URL: server.URL, Token: credential.Credential{Value: "wrong"}})
+	if _, err = ss.GetMembers("dba", ""); err == nil {
+		t.Error("expected an error for an invalid token")
+	}
+}
+
+func TestScimSourceMissingAttribute(t *testing.T) {
+	responses := scimUsers()
+	responses["/Users/u1"] = scimUser{Id: "u1", DisplayName: "alice"}
+	server := newScimStub(t, responses, nil)
+	ss := NewScimSource(ScimConfig{URL: server.URL, Token: credential.Credential{Value: "secret"}})
+	_, err := ss.GetMembers("dba", "")
+	if err == nil || !strings.Contains(err.Error(), "has no userName") {
+		t.Errorf("expected an error for a user without userName, got %v", err)
+	}
+}
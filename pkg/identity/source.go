@@ -0,0 +1,66 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+)
+
+// Source resolves a group into a membership tree.
+// The tree is built from ldap.Member objects (ldap was the first identity source), and the filter is only used by
+// sources that support it (e.a. the ldap filter). *ldap.Handler implements Source as well.
+type Source interface {
+	GetMembers(group string, filter string) (baseGroup *ldap.Member, err error)
+}
+
+// GroupMembers maps group names to the names of their members.
+// A member which is a group in the map as well, is a subgroup. All other members are users.
+type GroupMembers map[string][]string
+
+// Tree builds the membership tree for group
+func (gm GroupMembers) Tree(group string) (baseGroup *ldap.Member, err error) {
+	if _, exists := gm[group]; !exists {
+		return nil, fmt.Errorf("group %s not found", group)
+	}
+	members := make(ldap.Members)
+	baseGroup, err = members.GetById(group, true)
+	if err != nil {
+		return nil, err
+	}
+	err = baseGroup.SetMType(ldap.GroupMType)
+	if err != nil {
+		return nil, err
+	}
+	return baseGroup, gm.addMembers(members, baseGroup, map[string]bool{group: true})
+}
+
+// addMembers adds all members of parent (recursively). ancestors is used to detect cycles.
+func (gm GroupMembers) addMembers(members ldap.Members, parent *ldap.Member, ancestors map[string]bool) (err error) {
+	for _, name := range gm[parent.Name()] {
+		if ancestors[name] {
+			return fmt.Errorf("group %s is a member of itself (through %s)", name, parent.Name())
+		}
+		member, err := members.GetById(name, true)
+		if err != nil {
+			return err
+		}
+		member.AddParent(parent)
+		if _, isGroup := gm[name]; !isGroup {
+			err = member.SetMType(ldap.UserMType)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = member.SetMType(ldap.GroupMType)
+		if err != nil {
+			return err
+		}
+		ancestors[name] = true
+		err = gm.addMembers(members, member, ancestors)
+		if err != nil {
+			return err
+		}
+		delete(ancestors, name)
+	}
+	return nil
+}
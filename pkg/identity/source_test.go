@@ -0,0 +1,40 @@
+package identity
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	Initialize(zap.NewNop().Sugar())
+	os.Exit(m.Run())
+}
+
+// memberships returns all memberships of a tree as "member>group" strings (sorted)
+func memberships(baseGroup *ldap.Member) (mss []string) {
+	for _, ms := range baseGroup.MembershipTree() {
+		mss = append(mss, ms.Member.Name()+">"+ms.MemberOf.Name())
+	}
+	sort.Strings(mss)
+	return mss
+}
+
+func assertMemberships(t *testing.T, baseGroup *ldap.Member, expected ...string) {
+	t.Helper()
+	sort.Strings(expected)
+	if got := memberships(baseGroup); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected memberships %v, got %v", expected, got)
+	}
+}
+
+func TestGroupMembersCycle(t *testing.T) {
+	_, err := GroupMembers{"a": {"b"}, "b": {"a"}}.Tree("a")
+	if err == nil {
+		t.Error("expected an error for a group that is a member of itself")
+	}
+}
@@ -0,0 +1,87 @@
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/ldap"
+	"os"
+	"strings"
+)
+
+const defaultGroupFile = "/etc/group"
+
+// UnixConfig configures reading local unix groups from a group file (name:password:gid:members).
+// Only supplementary members (the members field) are read, primary group membership from /etc/passwd is not.
+type UnixConfig struct {
+	Path string `yaml:"path"`
+}
+
+type UnixSource struct {
+	config UnixConfig
+	groups GroupMembers
+}
+
+func NewUnixSource(config UnixConfig) (us *UnixSource) {
+	if config.Path == "" {
+		config.Path = defaultGroupFile
+	}
+	return &UnixSource{
+		config: config,
+	}
+}
+
+func (us *UnixSource) load() (err error) {
+	if us.groups != nil {
+		return nil
+	}
+	// The intent is to read groups from a configured file.
+	// #nosec
+	file, err := os.Open(us.config.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	groups := make(GroupMembers)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 4 {
+			log.Debugf("skipping invalid line in %s: %s", us.config.Path, line)
+			continue
+		}
+		groups[fields[0]] = []string{}
+		for _, member := range strings.Split(fields[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				groups[fields[0]] = append(groups[fields[0]], member)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	us.groups = groups
+	return nil
+}
+
+func (us *UnixSource) GetMembers(group string, filter string) (baseGroup *ldap.Member, err error) {
+	err = us.load()
+	if err != nil {
+		return nil, err
+	}
+	members, exists := us.groups[group]
+	if !exists {
+		return nil, fmt.Errorf("group %s not found in %s", group, us.config.Path)
+	}
+	// Unix groups cannot be nested, so all members are users (even when a group with the same name exists)
+	var users []string
+	for _, member := range members {
+		if member != group {
+			users = append(users, member)
+		}
+	}
+	return GroupMembers{group: users}.Tree(group)
+}
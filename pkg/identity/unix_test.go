@@ -0,0 +1,25 @@
+package identity
+
+import (
+	"testing"
+)
+
+func TestUnixSource(t *testing.T) {
+	us := NewUnixSource(UnixConfig{Path: "testdata/group"})
+	baseGroup, err := us.GetMembers("dba", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dba itself is skipped, since unix groups cannot be nested
+	assertMemberships(t, baseGroup, "alice>dba", "bob>dba")
+
+	baseGroup, err = us.GetMembers("oncall", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMemberships(t, baseGroup)
+
+	if _, err = us.GetMembers("missing", ""); err == nil {
+		t.Error("expected an error for a group that does not exist")
+	}
+}
@@ -0,0 +1,180 @@
+package ldap
+
+import (
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultUserFilter = "(uid=%s)"
+	// windowsEpochOffset is the number of 100ns intervals between 1601-01-01 and 1970-01-01
+	windowsEpochOffset = 116444736000000000
+	// adAccountDisable is the ACCOUNTDISABLE flag in the userAccountControl attribute
+	adAccountDisable = 0x2
+)
+
+// AttributeMapping maps ldap user attributes to postgres role settings.
+// When BaseDN is empty, no user attributes are retrieved at all.
+type AttributeMapping struct {
+	BaseDN          string `yaml:"basedn"`
+	Filter          string `yaml:"filter"`
+	Expiry          string `yaml:"expiry"`
+	Disabled        string `yaml:"disabled"`
+	ConnectionLimit string `yaml:"connection_limit"`
+	Comment         string `yaml:"comment"`
+}
+
+func (am AttributeMapping) Enabled() bool {
+	return am.BaseDN != ""
+}
+
+func (am AttributeMapping) attributeNames() (names []string) {
+	for _, name := range []string{am.Expiry, am.Disabled, am.ConnectionLimit, am.Comment} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UserSettings holds the postgres role settings derived from ldap user attributes.
+// The Has* fields are only true when the applicable attribute is mapped.
+type UserSettings struct {
+	HasExpiry          bool
+	Expiry             time.Time
+	Disabled           bool
+	HasConnectionLimit bool
+	ConnectionLimit    int
+	HasComment         bool
+	Comment            string
+}
+
+// parseExpiry parses an expiry attribute. A zero time means the account does not expire.
+func parseExpiry(attribute string, value string) (expiry time.Time, err error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	switch strings.ToLower(attribute) {
+	case "accountexpires":
+		// Active Directory: 100ns intervals since 1601-01-01, 0 and MaxInt64 mean never
+		fileTime, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fileTime == 0 || fileTime == 1<<63-1 {
+			return time.Time{}, nil
+		}
+		return time.Unix(0, (fileTime-windowsEpochOffset)*100).UTC(), nil
+	case "shadowexpire":
+		// shadowAccount: days since 1970-01-01, -1 means never
+		days, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if days < 0 {
+			return time.Time{}, nil
+		}
+		return time.Unix(days*24*60*60, 0).UTC(), nil
+	}
+	// Generalized time (e.a. 20220101000000Z)
+	for _, layout := range []string{"20060102150405Z0700", "20060102150405.0Z0700"} {
+		expiry, err = time.Parse(layout, value)
+		if err == nil {
+			return expiry, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %s as expiry from attribute %s", value, attribute)
+}
+
+// parseDisabled parses an attribute that flags an account as disabled
+func parseDisabled(attribute string, value string) (disabled bool, err error) {
+	if value == "" {
+		return false, nil
+	}
+	if strings.ToLower(attribute) == "useraccountcontrol" {
+		uac, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return uac&adAccountDisable != 0, nil
+	}
+	switch strings.ToLower(value) {
+	case "true", "yes", "1":
+		return true, nil
+	}
+	return false, nil
+}
+
+// fetchAttributes retrieves the mapped attributes for a user from ldap (only once per user)
+func (lh *Handler) fetchAttributes(m *Member) (err error) {
+	am := lh.config.UserAttributes
+	if m.attributes != nil {
+		return nil
+	}
+	filter := am.Filter
+	if filter == "" {
+		filter = defaultUserFilter
+	}
+	searchRequest := ldap.NewSearchRequest(am.BaseDN, ldap.ScopeWholeSubtree, ldap.DerefAlways, 0,
+		lh.config.TimeLimitSeconds(), false, fmt.Sprintf(filter, ldap.EscapeFilter(m.Name())),
+		am.attributeNames(), nil)
+	sr, err := lh.search(searchRequest)
+	if err != nil {
+		return err
+	}
+	m.attributes = make(map[string]string)
+	if len(sr.Entries) == 0 {
+		log.Debugf("user %s not found in %s, no attributes to map", m.Name(), am.BaseDN)
+		return nil
+	}
+	if len(sr.Entries) > 1 {
+		return fmt.Errorf("user %s is ambiguous (%d entries found in %s)", m.Name(), len(sr.Entries), am.BaseDN)
+	}
+	for _, name := range am.attributeNames() {
+		m.attributes[name] = sr.Entries[0].GetAttributeValue(name)
+	}
+	return nil
+}
+
+// UserSettings returns the postgres role settings for a user, derived from its ldap attributes
+func (lh *Handler) UserSettings(m *Member) (us UserSettings, err error) {
+	am := lh.config.UserAttributes
+	if !am.Enabled() || m.GetMType() != UserMType {
+		return us, nil
+	}
+	err = lh.fetchAttributes(m)
+	if err != nil {
+		return us, err
+	}
+	if am.Expiry != "" {
+		us.HasExpiry = true
+		us.Expiry, err = parseExpiry(am.Expiry, m.attributes[am.Expiry])
+		if err != nil {
+			return us, err
+		}
+	}
+	if am.Disabled != "" {
+		us.Disabled, err = parseDisabled(am.Disabled, m.attributes[am.Disabled])
+		if err != nil {
+			return us, err
+		}
+	}
+	if am.ConnectionLimit != "" {
+		us.HasConnectionLimit = true
+		us.ConnectionLimit = -1
+		if value := m.attributes[am.ConnectionLimit]; value != "" {
+			us.ConnectionLimit, err = strconv.Atoi(value)
+			if err != nil {
+				return us, fmt.Errorf("invalid connection limit %s for user %s: %v", value, m.Name(), err)
+			}
+		}
+	}
+	if am.Comment != "" {
+		us.HasComment = true
+		us.Comment = m.attributes[am.Comment]
+	}
+	return us, nil
+}
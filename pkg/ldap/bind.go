@@ -0,0 +1,87 @@
+package ldap
+
+import (
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-ldap/ldap/v3/gssapi"
+	"strings"
+)
+
+const (
+	SimpleBind    = "simple"
+	AnonymousBind = "anonymous"
+	ExternalBind  = "external"
+	GssapiBind    = "gssapi"
+
+	defaultKrb5Conf = "/etc/krb5.conf"
+)
+
+// binder binds a connection to server with the configured bind method
+type binder func(conn *ldap.Conn, server string) (err error)
+
+// binder returns a function that binds with the configured bind method.
+// Credentials are resolved once, so that configuration errors are returned before any server is dialed.
+func (c Config) binder() (bind binder, err error) {
+	switch strings.ToLower(c.BindMethod) {
+	case "", SimpleBind:
+		user, err := c.User()
+		if err != nil {
+			return nil, err
+		}
+		pwd, err := c.Password()
+		if err != nil {
+			return nil, err
+		}
+		return func(conn *ldap.Conn, server string) error {
+			if !c.UsesTLS(server) {
+				log.Warnf("binding to ldap server %s without TLS (consider ldaps:// or start_tls)", server)
+			}
+			return conn.Bind(user, pwd)
+		}, nil
+	case AnonymousBind:
+		return func(conn *ldap.Conn, server string) error {
+			return conn.UnauthenticatedBind("")
+		}, nil
+	case ExternalBind:
+		return func(conn *ldap.Conn, server string) error {
+			if c.CertFile == "" && !strings.HasPrefix(strings.ToLower(server), "ldapi://") {
+				return fmt.Errorf("bind_method external requires a client certificate (cert_file and key_file) or ldapi://")
+			}
+			return conn.ExternalBind()
+		}, nil
+	case GssapiBind:
+		user, err := c.User()
+		if err != nil {
+			return nil, err
+		}
+		if c.Keytab == "" {
+			return nil, fmt.Errorf("bind_method gssapi requires a keytab")
+		}
+		return func(conn *ldap.Conn, server string) error {
+			client, err := gssapi.NewClientWithKeytab(user, c.Realm, c.Keytab, c.Krb5Conf)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			spn, err := c.servicePrincipal(server)
+			if err != nil {
+				return err
+			}
+			return conn.GSSAPIBind(client, spn, "")
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid bind_method %s (should be one of %s, %s, %s or %s)", c.BindMethod,
+		SimpleBind, AnonymousBind, ExternalBind, GssapiBind)
+}
+
+// servicePrincipal returns the configured service principal, or derives ldap/<host> from the server url
+func (c Config) servicePrincipal(server string) (spn string, err error) {
+	if c.ServicePrincipal != "" {
+		return c.ServicePrincipal, nil
+	}
+	host, err := serverHost(server)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ldap/%s", host), nil
+}
@@ -1,16 +1,78 @@
 package ldap
 
+import (
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+	"time"
+)
+
+const (
+	defaultPageSize      = 500
+	defaultConnTimeout   = 10 * time.Second
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = 30 * time.Second
+)
+
 type Config struct {
-	Usr        Credential `yaml:"user"`
-	Pwd        Credential `yaml:"password"`
-	Servers    []string   `yaml:"servers"`
-	MaxRetries int        `yaml:"conn_retries"`
+	Usr              credential.Credential `yaml:"user"`
+	Pwd              credential.Credential `yaml:"password"`
+	Servers          []string              `yaml:"servers"`
+	MaxRetries       int                   `yaml:"conn_retries"`
+	CAFile           string                `yaml:"ca_file"`
+	CertFile         string                `yaml:"cert_file"`
+	KeyFile          string                `yaml:"key_file"`
+	ServerName       string                `yaml:"server_name"`
+	StartTLS         bool                  `yaml:"start_tls"`
+	TLSMinVersion    string                `yaml:"tls_min_version"`
+	PageSize         uint32                `yaml:"page_size"`
+	TimeLimit        time.Duration         `yaml:"search_time_limit"`
+	ConnTimeout      time.Duration         `yaml:"conn_timeout"`
+	OpTimeout        time.Duration         `yaml:"op_timeout"`
+	RetryDelay       time.Duration         `yaml:"retry_delay"`
+	MaxRetryDelay    time.Duration         `yaml:"max_retry_delay"`
+	BindMethod       string                `yaml:"bind_method"`
+	Keytab           string                `yaml:"keytab"`
+	Krb5Conf         string                `yaml:"krb5_conf"`
+	Realm            string                `yaml:"realm"`
+	ServicePrincipal string                `yaml:"service_principal"`
+	UserAttributes   AttributeMapping      `yaml:"user_attributes"`
+	SnapshotFile     string                `yaml:"snapshot_file"`
+	SnapshotMode     string                `yaml:"snapshot_mode"`
 }
 
 func (c *Config) SetDefaults() {
 	if c.MaxRetries < 1 {
 		c.MaxRetries = 1
 	}
+	if c.PageSize < 1 {
+		c.PageSize = defaultPageSize
+	}
+	if c.Krb5Conf == "" {
+		c.Krb5Conf = defaultKrb5Conf
+	}
+	if c.ConnTimeout <= 0 {
+		c.ConnTimeout = defaultConnTimeout
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = defaultRetryDelay
+	}
+	if c.MaxRetryDelay < c.RetryDelay {
+		c.MaxRetryDelay = defaultMaxRetryDelay
+		if c.MaxRetryDelay < c.RetryDelay {
+			c.MaxRetryDelay = c.RetryDelay
+		}
+	}
+}
+
+// TimeLimitSeconds returns the search time limit in (whole) seconds as used in ldap search requests
+func (c Config) TimeLimitSeconds() int {
+	if c.TimeLimit <= 0 {
+		return 0
+	}
+	seconds := int(c.TimeLimit / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
 }
 
 func (c Config) User() (user string, err error) {
@@ -3,12 +3,18 @@ package ldap
 import (
 	"fmt"
 	"github.com/go-ldap/ldap/v3"
+	"net"
+	"strings"
+	"time"
 )
 
 type Handler struct {
 	config  Config
 	conn    *ldap.Conn
 	members Members
+	// queries are recorded for saving a snapshot, and snapshot is set when a snapshot is replayed
+	queries  []query
+	snapshot *Snapshot
 }
 
 func NewLdapHandler(config Config) (lh *Handler) {
@@ -19,57 +25,169 @@ func NewLdapHandler(config Config) (lh *Handler) {
 	}
 }
 
+func (lh *Handler) dialServer(server string, bind binder) (conn *ldap.Conn, err error) {
+	tlsConfig, err := lh.config.TLSConfig(server)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: lh.config.ConnTimeout}
+	conn, err = ldap.DialURL(server, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %v", err)
+	}
+	conn.SetTimeout(lh.config.OpTimeout)
+	if lh.config.StartTLS {
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls failed: %v", err)
+		}
+	}
+	err = bind(conn, server)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bind failed: %v", err)
+	}
+	return conn, nil
+}
+
+// Connect connects to the first ldap server that can be dialed and bound to.
+// All servers are tried in order (failover) and with MaxRetries > 1, all servers are tried again after a
+// (exponentially growing) delay.
 func (lh *Handler) Connect() (err error) {
 	if lh.conn != nil {
-		return nil
+		if !lh.conn.IsClosing() {
+			return nil
+		}
+		log.Infof("ldap connection was closed, reconnecting")
+		lh.conn = nil
+	}
+	bind, err := lh.config.binder()
+	if err != nil {
+		return err
 	}
+	var serverErrors []string
+	delay := lh.config.RetryDelay
 	for i := 0; i < lh.config.MaxRetries; i++ {
+		if i > 0 {
+			log.Debugf("none of the ldap servers are available, retrying in %s", delay)
+			time.Sleep(delay)
+			delay *= 2
+			if delay > lh.config.MaxRetryDelay {
+				delay = lh.config.MaxRetryDelay
+			}
+		}
 		for _, server := range lh.config.Servers {
-			conn, err := ldap.DialURL(server)
+			conn, err := lh.dialServer(server, bind)
 			if err != nil {
+				log.Debugf("could not connect to ldap server %s (attempt %d): %v", server, i+1, err)
+				serverErrors = append(serverErrors, fmt.Sprintf("%s (attempt %d): %v", server, i+1, err))
 				continue
 			}
-			user, err := lh.config.User()
-			if err != nil {
-				return err
-			}
-			pwd, err := lh.config.Password()
-			if err != nil {
-				return err
-			}
-			err = conn.Bind(user, pwd)
-			if err != nil {
-				return err
-			}
+			log.Debugf("connected to ldap server %s", server)
 			lh.conn = conn
 			return nil
 		}
 	}
-	return fmt.Errorf("none of the ldap servers are available")
+	if len(serverErrors) == 0 {
+		return fmt.Errorf("none of the ldap servers are available (no servers configured)")
+	}
+	return fmt.Errorf("none of the ldap servers are available: %s", strings.Join(serverErrors, "; "))
+}
+
+// search runs a paged search, and reconnects (once) when the connection was lost mid-run
+func (lh *Handler) search(searchRequest *ldap.SearchRequest) (sr *ldap.SearchResult, err error) {
+	err = lh.Connect()
+	if err != nil {
+		return nil, err
+	}
+	// Paged searches prevent servers (e.a. AD) from truncating results at their size limit
+	sr, err = lh.conn.SearchWithPaging(searchRequest, lh.config.PageSize)
+	if err == nil || !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		return sr, err
+	}
+	log.Infof("ldap connection lost (%v), reconnecting", err)
+	lh.conn.Close()
+	lh.conn = nil
+	err = lh.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return lh.conn.SearchWithPaging(searchRequest, lh.config.PageSize)
 }
 
-func (lh Handler) GetMembers(baseDN string, filter string) (baseGroup *Member, err error) {
+func (lh *Handler) GetMembers(baseDN string, filter string) (baseGroup *Member, err error) {
+	switch lh.config.SnapshotMode {
+	case "":
+	case SnapshotReplay:
+		return lh.replay(baseDN, filter)
+	case SnapshotRecord, SnapshotFallback:
+		if lh.config.SnapshotFile == "" {
+			return nil, fmt.Errorf("snapshot_file must be set for snapshot_mode %s", lh.config.SnapshotMode)
+		}
+	default:
+		return nil, fmt.Errorf("invalid snapshot_mode %s (should be one of %s, %s or %s)", lh.config.SnapshotMode,
+			SnapshotRecord, SnapshotReplay, SnapshotFallback)
+	}
+	if lh.snapshot != nil {
+		// ldap was unavailable before, so keep using the snapshot for consistency
+		return lh.replay(baseDN, filter)
+	}
+	q := query{baseDN: baseDN, filter: filter}
+	for _, recorded := range lh.queries {
+		if recorded.key() == q.key() {
+			// resolved before (when planning), so return exactly what was recorded in the snapshot
+			return recorded.baseGroup, nil
+		}
+	}
 	err = lh.Connect()
+	if err != nil {
+		if lh.config.SnapshotMode != SnapshotFallback {
+			return nil, err
+		}
+		log.Warnf("ldap is unavailable (%v), falling back to snapshot %s", err, lh.config.SnapshotFile)
+		return lh.replay(baseDN, filter)
+	}
+	baseGroup, err = lh.getMembers(baseDN, filter)
 	if err != nil {
 		return nil, err
 	}
+	q.baseGroup = baseGroup
+	lh.queries = append(lh.queries, q)
+	return baseGroup, nil
+}
+
+func (lh *Handler) getMembers(baseDN string, filter string) (baseGroup *Member, err error) {
 	baseGroup, err = lh.members.GetById(baseDN, true)
 	if err != nil {
 		return nil, err
 	}
-	searchRequest := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.DerefAlways, 0, 0, false,
-		filter, []string{"dn", "cn", "memberUid"}, nil)
-	sr, err := lh.conn.Search(searchRequest)
+	searchRequest := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.DerefAlways, 0,
+		lh.config.TimeLimitSeconds(), false, filter, []string{"dn", "cn", "memberUid"}, nil)
+	sr, err := lh.search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
+	// Every entry is linked to its parent in the directory tree (when that is part of the results as well),
+	// or directly to the base group otherwise
+	groups := make(map[string]*Member)
 	for _, entry := range sr.Entries {
 		group, err := lh.members.GetById(entry.DN, true)
 		if err != nil {
 			return nil, err
 		}
-		group.AddParent(baseGroup)
+		groups[strings.ToLower(entry.DN)] = group
+	}
+	for _, entry := range sr.Entries {
+		group := groups[strings.ToLower(entry.DN)]
+		parent := baseGroup
+		if rdns := strings.SplitN(entry.DN, ",", 2); len(rdns) == 2 {
+			if dnParent, exists := groups[strings.ToLower(rdns[1])]; exists {
+				parent = dnParent
+			}
+		}
+		group.AddParent(parent)
 		for _, memberUid := range entry.GetAttributeValues("memberUid") {
 			member, err := lh.members.GetById(memberUid, true)
 			if err != nil {
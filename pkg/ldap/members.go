@@ -14,6 +14,25 @@ const (
 	UnknownMType
 )
 
+var memberTypeNames = map[MemberType]string{
+	GroupMType:   "group",
+	UserMType:    "user",
+	UnknownMType: "unknown",
+}
+
+func (mt MemberType) String() string {
+	return memberTypeNames[mt]
+}
+
+func toMemberType(name string) (mt MemberType) {
+	for mt, mtName := range memberTypeNames {
+		if mtName == name {
+			return mt
+		}
+	}
+	return UnknownMType
+}
+
 type Member struct {
 	dn       string
 	pair     string
@@ -21,6 +40,8 @@ type Member struct {
 	mType    MemberType
 	parents  Members
 	children Members
+	// attributes holds the mapped ldap attributes (only for users, and only when fetched)
+	attributes map[string]string
 }
 
 func validDn(dn string) bool {
@@ -122,7 +143,7 @@ func (m *Member) Dn() (dn string) {
 }
 
 func (m *Member) AddParent(p *Member) {
-	if m.dn == p.dn {
+	if m == p || (m.dn != "" && m.dn == p.dn) {
 		// This is me, myself and I. Skipping.
 		return
 	}
@@ -0,0 +1,200 @@
+package ldap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// SnapshotRecord queries ldap and writes all resolved memberships to the snapshot file
+	SnapshotRecord = "record"
+	// SnapshotReplay reads all memberships from the snapshot file, and does not connect to ldap at all
+	SnapshotReplay = "replay"
+	// SnapshotFallback is like SnapshotRecord, but replays the snapshot file when ldap is unavailable
+	SnapshotFallback = "fallback"
+)
+
+// Snapshot is the (json) representation of all memberships that where resolved from ldap
+type Snapshot struct {
+	Created time.Time       `json:"created"`
+	Queries []SnapshotQuery `json:"queries"`
+}
+
+// SnapshotQuery holds all members that were resolved by one GetMembers call
+type SnapshotQuery struct {
+	BaseDN  string           `json:"basedn"`
+	Filter  string           `json:"filter"`
+	Members []SnapshotMember `json:"members"`
+}
+
+type SnapshotMember struct {
+	Id         string            `json:"id"`
+	Type       string            `json:"type"`
+	Parents    []string          `json:"parents,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type query struct {
+	baseDN    string
+	filter    string
+	baseGroup *Member
+}
+
+func (q query) key() string {
+	return fmt.Sprintf("%s|%s", q.baseDN, q.filter)
+}
+
+// id returns the most specific identifier of a member
+func (m *Member) id() string {
+	if m.dn != "" {
+		return m.dn
+	}
+	if m.pair != "" {
+		return m.pair
+	}
+	return m.name
+}
+
+func newSnapshotQuery(q query) (sq SnapshotQuery) {
+	sq = SnapshotQuery{
+		BaseDN: q.baseDN,
+		Filter: q.filter,
+	}
+	members := []*Member{q.baseGroup}
+	seen := map[*Member]bool{q.baseGroup: true}
+	for _, ms := range q.baseGroup.MembershipTree() {
+		if !seen[ms.Member] {
+			seen[ms.Member] = true
+			members = append(members, ms.Member)
+		}
+	}
+	for _, m := range members {
+		sm := SnapshotMember{
+			Id:         m.id(),
+			Type:       m.mType.String(),
+			Attributes: m.attributes,
+		}
+		for _, p := range m.parents {
+			if seen[p] {
+				sm.Parents = append(sm.Parents, p.id())
+			}
+		}
+		sq.Members = append(sq.Members, sm)
+	}
+	return sq
+}
+
+// replay rebuilds the members for a query from the snapshot
+func (lh *Handler) replay(baseDN string, filter string) (baseGroup *Member, err error) {
+	if lh.snapshot == nil {
+		lh.snapshot, err = readSnapshot(lh.config.SnapshotFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("using ldap snapshot %s created at %s", lh.config.SnapshotFile, lh.snapshot.Created)
+	}
+	q := query{baseDN: baseDN, filter: filter}
+	for _, sq := range lh.snapshot.Queries {
+		if (query{baseDN: sq.BaseDN, filter: sq.Filter}).key() != q.key() {
+			continue
+		}
+		for _, sm := range sq.Members {
+			m, err := lh.members.GetById(sm.Id, true)
+			if err != nil {
+				return nil, err
+			}
+			err = m.SetMType(toMemberType(sm.Type))
+			if err != nil {
+				return nil, err
+			}
+			if sm.Attributes != nil {
+				m.attributes = sm.Attributes
+			} else if lh.config.UserAttributes.Enabled() {
+				// Nothing was recorded, which means nothing could be found, so no need to query ldap
+				m.attributes = make(map[string]string)
+			}
+		}
+		for _, sm := range sq.Members {
+			m, err := lh.members.GetById(sm.Id, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, parentId := range sm.Parents {
+				p, err := lh.members.GetById(parentId, false)
+				if err != nil {
+					return nil, err
+				}
+				m.AddParent(p)
+			}
+		}
+		return lh.members.GetById(baseDN, false)
+	}
+	return nil, fmt.Errorf("ldap snapshot %s has no entry for basedn %s and filter %s", lh.config.SnapshotFile,
+		baseDN, filter)
+}
+
+func readSnapshot(filename string) (s *Snapshot, err error) {
+	// The intent is to read a snapshot from a configured file.
+	// #nosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s = &Snapshot{}
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap snapshot %s: %v", filename, err)
+	}
+	return s, nil
+}
+
+// SaveSnapshot writes all memberships resolved from ldap during this run to the snapshot file.
+// It is a noop unless snapshot_mode is record or fallback, or when the snapshot was replayed.
+func (lh *Handler) SaveSnapshot() (err error) {
+	switch lh.config.SnapshotMode {
+	case SnapshotRecord, SnapshotFallback:
+	default:
+		return nil
+	}
+	if lh.snapshot != nil {
+		log.Infof("not saving ldap snapshot, since it was replayed")
+		return nil
+	}
+	s := Snapshot{
+		Created: time.Now().UTC(),
+	}
+	for _, q := range lh.queries {
+		if lh.config.UserAttributes.Enabled() {
+			// Make sure attributes are recorded for all users, so that a replay has them available
+			for _, ms := range q.baseGroup.MembershipTree() {
+				if ms.Member.GetMType() != UserMType {
+					continue
+				}
+				err = lh.fetchAttributes(ms.Member)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		s.Queries = append(s.Queries, newSnapshotQuery(q))
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename, so that a failing write never leaves a partial snapshot behind
+	tmpFile := filepath.Join(filepath.Dir(lh.config.SnapshotFile), "."+filepath.Base(lh.config.SnapshotFile)+".tmp")
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile, lh.config.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	log.Infof("ldap snapshot written to %s", lh.config.SnapshotFile)
+	return nil
+}
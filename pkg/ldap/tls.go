@@ -0,0 +1,92 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(version string) (tlsVersion uint16, err error) {
+	version = strings.TrimPrefix(strings.ToLower(version), "tls")
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	if tlsVersion, exists := tlsVersions[version]; exists {
+		return tlsVersion, nil
+	}
+	return 0, fmt.Errorf("invalid tls_min_version %s (should be one of 1.0, 1.1, 1.2 or 1.3)", version)
+}
+
+// serverHost returns the hostname (without port) from a ldap server url
+func serverHost(server string) (host string, err error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	host, _, err = net.SplitHostPort(u.Host)
+	if err != nil {
+		// we assume that error is due to missing port
+		host = u.Host
+	}
+	return host, nil
+}
+
+// UsesTLS returns true if a connection to server will be encrypted (either ldaps:// or StartTLS)
+func (c Config) UsesTLS(server string) bool {
+	return c.StartTLS || strings.HasPrefix(strings.ToLower(server), "ldaps://")
+}
+
+// TLSConfig returns the tls.Config to be used for connecting to server.
+// When no ServerName is configured, the hostname is derived from the server url.
+func (c Config) TLSConfig(server string) (tlsConfig *tls.Config, err error) {
+	minVersion, err := parseTLSVersion(c.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig = &tls.Config{
+		MinVersion: minVersion,
+		ServerName: c.ServerName,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, err = serverHost(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.CAFile != "" {
+		// The intent is to read a CA bundle from a configured file.
+		// #nosec
+		caPem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no valid certificates found in ca_file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("both cert_file and key_file must be set for ldap client certificates")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
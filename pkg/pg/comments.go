@@ -0,0 +1,173 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// objectType describes how comments and security labels are stored for a type of object
+type objectType struct {
+	// sql is the object type as used in COMMENT ON and SECURITY LABEL statements
+	sql string
+	// catalog and nameColumn are used to find the object by name
+	catalog    string
+	nameColumn string
+	// classCatalog is the catalog that holds the object (classoid in pg_(sh)description and pg_(sh)seclabel)
+	classCatalog string
+	// shared objects (roles and databases) store comments in pg_shdescription and labels in pg_shseclabel
+	shared bool
+}
+
+var (
+	roleObject      = objectType{"ROLE", "pg_roles", "rolname", "pg_authid", true}
+	databaseObject  = objectType{"DATABASE", "pg_database", "datname", "pg_database", true}
+	schemaObject    = objectType{"SCHEMA", "pg_namespace", "nspname", "pg_namespace", false}
+	extensionObject = objectType{"EXTENSION", "pg_extension", "extname", "pg_extension", false}
+)
+
+// Metadata holds the comment and security labels (by provider, e.a. selinux) of an object.
+// When Comment is nil, the comment is not managed. Only security labels for configured providers are managed.
+type Metadata struct {
+	Comment        *string           `yaml:"comment"`
+	SecurityLabels map[string]string `yaml:"security_labels"`
+}
+
+func (ot objectType) description() string {
+	if ot.shared {
+		return fmt.Sprintf("shobj_description(oid, '%s')", ot.classCatalog)
+	}
+	return fmt.Sprintf("obj_description(oid, '%s')", ot.classCatalog)
+}
+
+// setComment sets the comment of an object when it differs
+func setComment(c *Conn, ot objectType, name string, comment string) (err error) {
+	checkQry := fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1 AND COALESCE(%s, '') != $2", ot.nameColumn, ot.catalog,
+		ot.nameColumn, ot.description())
+	exists, err := c.runQueryExists(checkQry, name, comment)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	commentSql := "NULL"
+	if comment != "" {
+		commentSql = quotedSqlValue(comment)
+	}
+	err = c.runQueryExec(fmt.Sprintf("COMMENT ON %s %s IS %s", ot.sql, identifier(name), commentSql))
+	if err != nil {
+		return err
+	}
+	log.Infof("Succesfully set comment for %s '%s'", ot.sql, name)
+	return nil
+}
+
+// getSecurityLabels returns the current security labels of an object (by provider)
+func getSecurityLabels(c *Conn, ot objectType, name string) (labels map[string]string, err error) {
+	err = c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	qry := fmt.Sprintf(`SELECT l.provider, l.label FROM pg_shseclabel l INNER JOIN %s o ON l.objoid = o.oid
+		WHERE l.classoid = '%s'::regclass AND o.%s = $1`, ot.catalog, ot.classCatalog, ot.nameColumn)
+	if !ot.shared {
+		qry = fmt.Sprintf(`SELECT l.provider, l.label FROM pg_seclabel l INNER JOIN %s o ON l.objoid = o.oid
+		WHERE l.classoid = '%s'::regclass AND l.objsubid = 0 AND o.%s = $1`, ot.catalog, ot.classCatalog,
+			ot.nameColumn)
+	}
+	rows, err := c.conn.Query(context.Background(), qry, name)
+	if err != nil {
+		return nil, fmt.Errorf("getSecurityLabels (%s) failed: %v", qry, err)
+	}
+	defer rows.Close()
+	labels = make(map[string]string)
+	for rows.Next() {
+		var provider, label string
+		err = rows.Scan(&provider, &label)
+		if err != nil {
+			return nil, fmt.Errorf("getSecurityLabels (%s) failed: %v", qry, err)
+		}
+		labels[provider] = label
+	}
+	return labels, rows.Err()
+}
+
+// setSecurityLabels sets the security labels of an object for all configured providers where they differ.
+// An empty label removes the security label for that provider.
+func setSecurityLabels(c *Conn, ot objectType, name string, labels map[string]string) (err error) {
+	if len(labels) == 0 {
+		return nil
+	}
+	current, err := getSecurityLabels(c, ot, name)
+	if err != nil {
+		return err
+	}
+	providers := make([]string, 0, len(labels))
+	for provider := range labels {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		label := labels[provider]
+		if current[provider] == label {
+			continue
+		}
+		labelSql := "NULL"
+		if label != "" {
+			labelSql = quotedSqlValue(label)
+		}
+		err = c.runQueryExec(fmt.Sprintf("SECURITY LABEL FOR %s ON %s %s IS %s", identifier(provider), ot.sql,
+			identifier(name), labelSql))
+		if err != nil {
+			return err
+		}
+		log.Infof("Succesfully set security label for provider '%s' on %s '%s'", provider, ot.sql, name)
+	}
+	return nil
+}
+
+// setMetadata sets the comment (when managed) and security labels of an object
+func setMetadata(c *Conn, ot objectType, name string, metadata Metadata) (err error) {
+	if metadata.Comment != nil {
+		err = setComment(c, ot, name, *metadata.Comment)
+		if err != nil {
+			return err
+		}
+	}
+	return setSecurityLabels(c, ot, name, metadata.SecurityLabels)
+}
+
+// SetMetadata sets the comment and security labels of the role
+func (r Role) SetMetadata(metadata Metadata) (err error) {
+	return setMetadata(r.handler.conn, roleObject, r.name, metadata)
+}
+
+// SetMetadata sets the comment and security labels of the database, and of its schemas
+func (d *Database) SetMetadata() (err error) {
+	err = setMetadata(d.handler.conn, databaseObject, d.name, d.Metadata)
+	if err != nil {
+		return err
+	}
+	c := d.GetDbConnection()
+	for schemaName, schemaMetadata := range d.Schemas {
+		exists, err := c.runQueryExists("SELECT nspname FROM pg_namespace WHERE nspname = $1", schemaName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			log.Warnf("Schema '%s'.'%s' does not exist, skipping comment and security labels", d.name, schemaName)
+			continue
+		}
+		err = setMetadata(c, schemaObject, schemaName, schemaMetadata)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMetadata sets the comment and security labels of the extension
+func (e Extension) SetMetadata() (err error) {
+	return setMetadata(e.db.GetDbConnection(), extensionObject, e.name, e.Metadata)
+}
@@ -109,3 +109,24 @@ func (c *Conn) runQueryGetOneField(query string, args ...interface{}) (answer st
 	}
 	return answer, nil
 }
+
+func (c *Conn) runQueryGetOneColumn(query string, args ...interface{}) (answers []string, err error) {
+	err = c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("runQueryGetOneColumn (%s) failed: %v", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var answer string
+		err = rows.Scan(&answer)
+		if err != nil {
+			return nil, fmt.Errorf("runQueryGetOneColumn (%s) failed: %v", query, err)
+		}
+		answers = append(answers, answer)
+	}
+	return answers, rows.Err()
+}
@@ -17,6 +17,9 @@ type Database struct {
 	Owner      string     `yaml:"owner"`
 	Extensions Extensions `yaml:"extensions"`
 	State      State      `yaml:"state"`
+	Metadata   `yaml:",inline"`
+	// Schemas holds the comment and security labels for schemas (which are not created by pgfga)
+	Schemas map[string]Metadata `yaml:"schemas"`
 }
 
 func NewDatabase(handler *Handler, name string, owner string) (d *Database) {
@@ -86,6 +89,10 @@ func (d *Database) Drop() (err error) {
 			return err
 		}
 		log.Infof("Database '%s' succesfully dropped", d.name)
+		err = ph.unmark(databaseMarker, d.name)
+		if err != nil {
+			return err
+		}
 	}
 	d.State = Absent
 	return nil
@@ -104,6 +111,10 @@ func (d Database) Create() (err error) {
 			return err
 		}
 		log.Infof("Database '%s' succesfully created", d.name)
+		err = ph.mark(databaseMarker, d.name)
+		if err != nil {
+			return err
+		}
 	}
 	exists, err = ph.conn.runQueryExists("SELECT datname FROM pg_database db inner join pg_roles rol on db.datdba = rol.oid WHERE datname = $1 and rolname = $2", d.name, d.Owner)
 	if err != nil {
@@ -122,20 +133,40 @@ func (d Database) Create() (err error) {
 		}
 		log.Infof("Database owner succesfully altered to '%s' on '%s'", d.Owner, d.name)
 	}
-	err = d.CreateOrDropExtensions()
+	err = d.SetMetadata()
 	if err != nil {
 		return err
 	}
-	err = ph.GrantRole(d.Owner, "opex")
+	err = d.CreateOrDropExtensions()
 	if err != nil {
 		return err
 	}
-	readOnlyRoleName := fmt.Sprintf("%s_readonly", d.name)
-	err = ph.GrantRole(readOnlyRoleName, "readonly")
-	if err != nil {
-		return err
+	for _, grant := range d.ImplicitGrants() {
+		err = ph.GrantRole(grant.Member, grant.Granted)
+		if err != nil {
+			return err
+		}
+	}
+	return d.SetReadOnlyGrants(d.readOnlyRoleName())
+}
+
+// Grant is a role (Granted) that is granted to another role (Member)
+type Grant struct {
+	Member  string
+	Granted string
+}
+
+func (d Database) readOnlyRoleName() string {
+	return fmt.Sprintf("%s_readonly", d.name)
+}
+
+// ImplicitGrants returns the memberships that are granted for a database: opex to its owner, and readonly to its
+// readonly role
+func (d Database) ImplicitGrants() (grants []Grant) {
+	return []Grant{
+		{Member: d.Owner, Granted: "opex"},
+		{Member: d.readOnlyRoleName(), Granted: "readonly"},
 	}
-	return d.SetReadOnlyGrants(readOnlyRoleName)
 }
 
 func (d Database) SetReadOnlyGrants(readOnlyRoleName string) (err error) {
@@ -185,6 +216,9 @@ func (d *Database) CreateOrDropExtensions() (err error) {
 	for _, e := range d.Extensions {
 		if e.State.Bool() {
 			err = e.Create()
+			if err == nil {
+				err = e.SetMetadata()
+			}
 		} else {
 			err = e.Drop()
 		}
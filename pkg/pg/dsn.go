@@ -0,0 +1,51 @@
+package pg
+
+import (
+	"fmt"
+	"github.com/mannemsolutions/pgfga/pkg/credential"
+	"os"
+	"path/filepath"
+)
+
+// DsnConfig holds the connection parameters as configured, where every value is a credential
+// (which can be set as a plain string as well)
+type DsnConfig map[string]credential.Credential
+
+// dsnFileParams are connection parameters that expect a path to a file
+var dsnFileParams = map[string]bool{
+	"passfile":    true,
+	"sslcert":     true,
+	"sslkey":      true,
+	"sslrootcert": true,
+}
+
+// Dsn resolves all credentials into a Dsn.
+// Parameters that expect a file (e.a. sslkey) are used as a path when set as plain string, but when set as a
+// credential object, the credential is written to a (0600) file in a temporary directory, which is returned as
+// tmpDir and should be removed by the caller.
+func (dc DsnConfig) Dsn() (dsn Dsn, tmpDir string, err error) {
+	dsn = make(Dsn)
+	for key, cred := range dc {
+		value, err := cred.GetCred()
+		if err != nil {
+			return nil, tmpDir, fmt.Errorf("could not get postgresql_dsn.%s: %v", key, err)
+		}
+		if !dsnFileParams[key] || cred.IsScalar() {
+			dsn[key] = value
+			continue
+		}
+		if tmpDir == "" {
+			tmpDir, err = os.MkdirTemp("", "pgfga")
+			if err != nil {
+				return nil, tmpDir, err
+			}
+		}
+		fileName := filepath.Join(tmpDir, key)
+		err = os.WriteFile(fileName, []byte(value), 0600)
+		if err != nil {
+			return nil, tmpDir, err
+		}
+		dsn[key] = fileName
+	}
+	return dsn, tmpDir, nil
+}
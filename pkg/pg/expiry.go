@@ -0,0 +1,140 @@
+package pg
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+const (
+	expiryFormat = `YYYY-MM-DD"T"HH24:MI:SS"Z"`
+	// passwordTable holds when the password of every role was changed (in the state database)
+	passwordTable = "pgfga.password_changes"
+)
+
+// SetNoLoginExpired configures the handler to set NOLOGIN (instead of LOGIN) for roles that have expired
+func (ph *Handler) SetNoLoginExpired(noLoginExpired bool) {
+	ph.noLoginExpired = noLoginExpired
+}
+
+func (ph *Handler) createPasswordTable() (err error) {
+	if ph.passwordTableExists {
+		return nil
+	}
+	err = ph.createStateTable(passwordTable, `role_name text PRIMARY KEY, fingerprint text NOT NULL,
+		changed timestamptz NOT NULL DEFAULT now()`)
+	if err != nil {
+		return err
+	}
+	ph.passwordTableExists = true
+	return nil
+}
+
+// PasswordChanged returns when the password of the role was changed, which is zero when the role has no password.
+// A fingerprint of the password hash is kept in the state table, so that changes are detected on the next run (also
+// when the password was changed outside of pgfga).
+func (r Role) PasswordChanged() (changed time.Time, err error) {
+	hashes, err := r.handler.conn.runQueryGetOneColumn(
+		`SELECT passwd FROM pg_shadow WHERE usename = $1 AND passwd IS NOT NULL`, r.name)
+	if err != nil || len(hashes) == 0 {
+		return changed, err
+	}
+	ph := r.handler
+	err = ph.createPasswordTable()
+	if err != nil {
+		return changed, err
+	}
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256([]byte(hashes[0])))
+	c := ph.markerConn()
+	answers, err := c.runQueryGetOneColumn(fmt.Sprintf(`SELECT to_char(changed AT TIME ZONE 'UTC', '%s') FROM %s
+		WHERE role_name = $1 AND fingerprint = $2`, expiryFormat, passwordTable), r.name, fingerprint)
+	if err != nil {
+		return changed, err
+	}
+	if len(answers) > 0 {
+		return time.Parse(time.RFC3339, answers[0])
+	}
+	log.Debugf("password of role %s has changed, recording the time of the change", r.name)
+	changed = time.Now().UTC().Truncate(time.Second)
+	err = c.runQueryExec(fmt.Sprintf(`INSERT INTO %s (role_name, fingerprint, changed) VALUES ($1, $2, $3)
+		ON CONFLICT (role_name) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, changed = EXCLUDED.changed`,
+		passwordTable), r.name, fingerprint, changed)
+	return changed, err
+}
+
+// forgetPasswordChange removes the password change time of a role that is dropped
+func (ph *Handler) forgetPasswordChange(roleName string) (err error) {
+	if !ph.passwordTableExists {
+		exists, err := ph.stateTableExists(passwordTable)
+		if err != nil || !exists {
+			return err
+		}
+		ph.passwordTableExists = true
+	}
+	return ph.markerConn().runQueryExec(fmt.Sprintf("DELETE FROM %s WHERE role_name = $1", passwordTable), roleName)
+}
+
+func (r Role) isExpired() (isExpired bool, err error) {
+	checkQry := `SELECT rolname FROM pg_roles WHERE rolname = $1 AND rolvaliduntil < now()`
+	return r.handler.conn.runQueryExists(checkQry, r.name)
+}
+
+// ExpiringRoles returns the expiry of all managed login roles that expire within the duration (or have expired)
+func (ph *Handler) ExpiringRoles(within time.Duration) (expiries map[string]time.Time, err error) {
+	c := ph.conn
+	err = c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	qry := fmt.Sprintf(`SELECT rolname, to_char(rolvaliduntil AT TIME ZONE 'UTC', '%s') FROM pg_roles
+		WHERE rolcanlogin AND rolvaliduntil IS NOT NULL AND rolvaliduntil != 'infinity'
+		AND rolvaliduntil < now() + $1 * interval '1 second'`, expiryFormat)
+	rows, err := c.conn.Query(context.Background(), qry, within.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ExpiringRoles (%s) failed: %v", qry, err)
+	}
+	defer rows.Close()
+	expiries = make(map[string]time.Time)
+	for rows.Next() {
+		var roleName, validUntil string
+		err = rows.Scan(&roleName, &validUntil)
+		if err != nil {
+			return nil, fmt.Errorf("ExpiringRoles (%s) failed: %v", qry, err)
+		}
+		if _, managed := ph.roles[roleName]; !managed {
+			continue
+		}
+		expiries[roleName], err = time.Parse(time.RFC3339, validUntil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expiries, rows.Err()
+}
+
+// HandleExpiredRoles sets NOLOGIN for all managed login roles that have expired, and LOGIN again for roles that
+// no longer are expired (e.a. when the expiry was extended)
+func (ph *Handler) HandleExpiredRoles() (err error) {
+	if !ph.noLoginExpired {
+		return nil
+	}
+	for _, role := range ph.roles {
+		option, exists := role.options[LoginOption.name]
+		if !role.State.Bool() || !exists || !option.enabled {
+			continue
+		}
+		expired, err := role.isExpired()
+		if err != nil {
+			return err
+		}
+		if expired {
+			option = LoginOption.Inverse()
+		}
+		err = role.setRoleOption(option)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,11 +8,12 @@ type Extensions map[string]*Extension
 
 type Extension struct {
 	// name and db are set by the database
-	db      *Database
-	name    string
-	Schema  string `yaml:"schema"`
-	State   State  `yaml:"state"`
-	Version string `yaml:"version"`
+	db       *Database
+	name     string
+	Schema   string `yaml:"schema"`
+	State    State  `yaml:"state"`
+	Version  string `yaml:"version"`
+	Metadata `yaml:",inline"`
 }
 
 func NewExtension(db *Database, name string, schema string, version string) (e *Extension, err error) {
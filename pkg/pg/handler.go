@@ -1,11 +1,26 @@
 package pg
 
+import (
+	"strconv"
+)
+
 type Handler struct {
 	conn          *Conn
 	strictOptions StrictOptions
 	databases     Databases
 	roles         Roles
 	slots         ReplicationSlots
+	// noLoginExpired sets NOLOGIN instead of LOGIN for roles that have expired
+	noLoginExpired bool
+	// serverVersion caches the server_version_num of the server
+	serverVersion int
+	// stateConn is the connection to the strict.state_database (when it differs from the default database)
+	stateConn         *Conn
+	markerTableExists bool
+	// markerFailed is set when marking an object failed (without strict), so that it is not tried again
+	markerFailed bool
+	// passwordTableExists is set once the table with the password change times is created
+	passwordTableExists bool
 }
 
 func NewPgHandler(connParams Dsn, options StrictOptions, databases Databases, slots []string) (ph *Handler) {
@@ -36,6 +51,19 @@ func (ph *Handler) setDefaults() {
 	}
 }
 
+// ServerVersion returns the server_version_num of the server (e.a. 160002 for 16.2)
+func (ph *Handler) ServerVersion() (version int, err error) {
+	if ph.serverVersion > 0 {
+		return ph.serverVersion, nil
+	}
+	answer, err := ph.conn.runQueryGetOneField("SHOW server_version_num")
+	if err != nil {
+		return 0, err
+	}
+	ph.serverVersion, err = strconv.Atoi(answer)
+	return ph.serverVersion, err
+}
+
 func (ph *Handler) GetDb(dbName string) (d *Database) {
 	// NewDatabase does everything we need to do
 	return NewDatabase(ph, dbName, "")
@@ -58,6 +86,43 @@ func (ph *Handler) GrantRole(granteeName string, grantedName string) (err error)
 	}
 	return grantee.GrantRole(granted)
 }
+
+// GrantMembership grants a role (with membership options) to granteeName
+func (ph *Handler) GrantMembership(granteeName string, m Membership) (err error) {
+	grantee, err := ph.GetRole(granteeName)
+	if err != nil {
+		return err
+	}
+	_, err = ph.GetRole(m.Role)
+	if err != nil {
+		return err
+	}
+	return grantee.GrantMembership(m)
+}
+func (ph *Handler) RevokeRole(granteeName string, grantedName string) (err error) {
+	grantee, err := ph.GetRole(granteeName)
+	if err != nil {
+		return err
+	}
+	return grantee.RevokeRole(grantedName)
+}
+
+// GetRoleMembers returns the names of all roles that are a direct member of roleName
+func (ph *Handler) GetRoleMembers(roleName string) (members []string, err error) {
+	qry := `select grantee.rolname from pg_auth_members auth inner join pg_roles
+		granted on auth.roleid = granted.oid inner join pg_roles
+		grantee on auth.member = grantee.oid where granted.rolname = $1`
+	return ph.conn.runQueryGetOneColumn(qry, roleName)
+}
+
+// GetRoleMemberships returns the names of all roles that roleName is a direct member of
+func (ph *Handler) GetRoleMemberships(roleName string) (granted []string, err error) {
+	qry := `select granted.rolname from pg_auth_members auth inner join pg_roles
+		granted on auth.roleid = granted.oid inner join pg_roles
+		grantee on auth.member = grantee.oid where grantee.rolname = $1`
+	return ph.conn.runQueryGetOneColumn(qry, roleName)
+}
+
 func (ph *Handler) CreateOrDropDatabases() (err error) {
 	for _, d := range ph.databases {
 		if d.State.Bool() {
@@ -86,11 +151,68 @@ func (ph *Handler) CreateOrDropSlots() (err error) {
 	return nil
 }
 
-func (ph *Handler) StrictifyRoles() (err error) {
+// StrictifyRoles drops all roles that are not managed in this run (with strict users). Unless strict is set to
+// all, only roles that were created by pgfga are dropped. guard can prevent the roles from being dropped.
+func (ph *Handler) StrictifyRoles(guard DropGuard) (err error) {
+	if !ph.strictOptions.Users {
+		return nil
+	}
+	existing, err := ph.conn.runQueryGetOneColumn(`SELECT rolname FROM pg_roles WHERE oid >= $1
+		AND rolname != CURRENT_USER AND rolname NOT LIKE 'pg\_%'`, firstNormalObjectId)
+	if err != nil {
+		return err
+	}
+	candidates, err := ph.strictCandidates(roleMarker, existing, func(name string) bool {
+		_, managed := ph.roles[name]
+		return managed
+	})
+	if err != nil {
+		return err
+	}
+	err = guard(roleMarker, candidates, len(existing))
+	if err != nil {
+		return err
+	}
+	for _, roleName := range candidates {
+		role := &Role{handler: ph, name: roleName, options: make(RoleOptions), State: Present}
+		err = role.Drop()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (ph *Handler) StrictifyDatabases() (err error) {
+// StrictifyDatabases drops all databases that are not managed in this run (with strict databases). Unless strict
+// is set to all, only databases that were created by pgfga are dropped. guard can prevent the databases from being
+// dropped.
+func (ph *Handler) StrictifyDatabases(guard DropGuard) (err error) {
+	if !ph.strictOptions.Databases {
+		return nil
+	}
+	existing, err := ph.conn.runQueryGetOneColumn(`SELECT datname FROM pg_database WHERE oid >= $1
+		AND NOT datistemplate AND datname != current_database()`, firstNormalObjectId)
+	if err != nil {
+		return err
+	}
+	candidates, err := ph.strictCandidates(databaseMarker, existing, func(name string) bool {
+		_, managed := ph.databases[name]
+		return managed || name == ph.strictOptions.StateDatabase
+	})
+	if err != nil {
+		return err
+	}
+	err = guard(databaseMarker, candidates, len(existing))
+	if err != nil {
+		return err
+	}
+	for _, dbName := range candidates {
+		db := &Database{handler: ph, name: dbName, Extensions: make(Extensions), State: Present}
+		err = db.Drop()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 func (ph *Handler) StrictifyExtensions() (err error) {
@@ -22,6 +22,10 @@ type StrictOptions struct {
 	Databases  bool `yaml:"databases"`
 	Extensions bool `yaml:"extensions"`
 	Slots      bool `yaml:"replication_slots"`
+	// All enables all strict options, and also drops objects that were not created by pgfga
+	All bool `yaml:"all"`
+	// StateDatabase is the database with the state table that marks the objects created by pgfga
+	StateDatabase string `yaml:"state_database"`
 }
 
 // identifier returns the object name ready to be used in a sql query as an object name (e.a. select * from %s)
@@ -0,0 +1,180 @@
+package pg
+
+import (
+	"fmt"
+)
+
+/*
+ * pgfga marks the objects it creates in a state table, so that strict cleanup (StrictifyRoles and
+ * StrictifyDatabases) only drops objects that were created by pgfga (unless strict is set to all).
+ */
+
+const (
+	markerSchema   = "pgfga"
+	markerTable    = "pgfga.managed_objects"
+	roleMarker     = "role"
+	databaseMarker = "database"
+	// firstNormalObjectId is the first oid for objects that are not created by initdb
+	firstNormalObjectId = 16384
+)
+
+// UnmarshalYAML allows strict to be set as `all`, or as an object
+func (so *StrictOptions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		if value != "all" {
+			return fmt.Errorf("invalid value %s for strict (should be all, or an object)", value)
+		}
+		so.All = true
+	} else {
+		type plain StrictOptions
+		if err := unmarshal((*plain)(so)); err != nil {
+			return err
+		}
+	}
+	if so.All {
+		so.Users, so.Databases, so.Extensions, so.Slots = true, true, true, true
+	}
+	return nil
+}
+
+// markerConn returns the connection to the database that holds the state table
+func (ph *Handler) markerConn() (c *Conn) {
+	dbName := ph.strictOptions.StateDatabase
+	if dbName == "" || dbName == ph.conn.DbName() {
+		return ph.conn
+	}
+	if ph.stateConn == nil {
+		connParams := make(map[string]string)
+		for key, value := range ph.conn.connParams {
+			connParams[key] = value
+		}
+		connParams["dbname"] = dbName
+		ph.stateConn = NewConn(connParams)
+	}
+	return ph.stateConn
+}
+
+// createStateTable creates a table (and the pgfga schema) in the state database
+func (ph *Handler) createStateTable(table string, columns string) (err error) {
+	c := ph.markerConn()
+	err = c.runQueryExec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", identifier(markerSchema)))
+	if err != nil {
+		return err
+	}
+	return c.runQueryExec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, columns))
+}
+
+// stateTableExists returns true when a table exists in the state database
+func (ph *Handler) stateTableExists(table string) (exists bool, err error) {
+	return ph.markerConn().runQueryExists("SELECT to_regclass($1)::text WHERE to_regclass($1) IS NOT NULL", table)
+}
+
+func (ph *Handler) createMarkerTable() (err error) {
+	if ph.markerTableExists {
+		return nil
+	}
+	err = ph.createStateTable(markerTable, `object_type text NOT NULL, object_name text NOT NULL,
+		created timestamptz NOT NULL DEFAULT now(), PRIMARY KEY (object_type, object_name)`)
+	if err != nil {
+		return err
+	}
+	ph.markerTableExists = true
+	return nil
+}
+
+// markerRequired returns true when objects of a type must be marked: with strict cleanup for the type, or when a
+// state_database is set
+func (ph *Handler) markerRequired(objectType string) bool {
+	if ph.strictOptions.StateDatabase != "" {
+		return true
+	}
+	switch objectType {
+	case roleMarker:
+		return ph.strictOptions.Users
+	case databaseMarker:
+		return ph.strictOptions.Databases
+	}
+	return false
+}
+
+// mark records that an object was created by pgfga. Objects are also marked without strict, so that they are
+// considered by strict cleanup once it is enabled. But without strict (and state_database) pgfga might lack the
+// privileges to create the state table, in which case a warning is logged and the object is not marked.
+func (ph *Handler) mark(objectType string, name string) (err error) {
+	if ph.markerFailed && !ph.markerRequired(objectType) {
+		return nil
+	}
+	err = ph.createMarkerTable()
+	if err == nil {
+		err = ph.markerConn().runQueryExec(fmt.Sprintf(`INSERT INTO %s (object_type, object_name) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, markerTable), objectType, name)
+	}
+	if err == nil || ph.markerRequired(objectType) {
+		return err
+	}
+	log.Warnf("could not mark %s %s as created by pgfga (%v), it will not be dropped by strict cleanup "+
+		"(unless strict is set to all)", objectType, name, err)
+	ph.markerFailed = true
+	return nil
+}
+
+// unmark removes the marker for an object that was dropped
+func (ph *Handler) unmark(objectType string, name string) (err error) {
+	if !ph.markerTableExists {
+		exists, err := ph.stateTableExists(markerTable)
+		if err != nil || !exists {
+			return err
+		}
+		ph.markerTableExists = true
+	}
+	return ph.markerConn().runQueryExec(fmt.Sprintf("DELETE FROM %s WHERE object_type = $1 AND object_name = $2",
+		markerTable), objectType, name)
+}
+
+// getMarked returns the names of all objects of a type that were created by pgfga
+func (ph *Handler) getMarked(objectType string) (marked map[string]bool, err error) {
+	err = ph.createMarkerTable()
+	if err != nil {
+		return nil, err
+	}
+	names, err := ph.markerConn().runQueryGetOneColumn(fmt.Sprintf(
+		"SELECT object_name FROM %s WHERE object_type = $1", markerTable), objectType)
+	if err != nil {
+		return nil, err
+	}
+	marked = make(map[string]bool)
+	for _, name := range names {
+		marked[name] = true
+	}
+	return marked, nil
+}
+
+// DropGuard is called with the objects that strict cleanup is about to drop, and the number of (non system) objects
+// of that type. It returns an error to prevent the objects from being dropped.
+type DropGuard func(objectType string, drops []string, existing int) (err error)
+
+// strictCandidates returns the objects that are not managed in this run, and that may be dropped: all of them with
+// strict set to all, and otherwise only the objects that were created by pgfga
+func (ph *Handler) strictCandidates(objectType string, existing []string, managed func(string) bool) (
+	candidates []string, err error) {
+	var marked map[string]bool
+	if !ph.strictOptions.All {
+		marked, err = ph.getMarked(objectType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range existing {
+		if managed(name) {
+			continue
+		}
+		if !ph.strictOptions.All && !marked[name] {
+			log.Debugf("not dropping %s %s, since it was not created by pgfga (strict is not set to all)",
+				objectType, name)
+			continue
+		}
+		candidates = append(candidates, name)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,158 @@
+package pg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Membership is a role that is granted to another role, with its membership options (ADMIN, and as of postgres 16
+// INHERIT and SET). Options that are not set are not managed.
+type Membership struct {
+	Role    string `yaml:"role"`
+	Admin   *bool  `yaml:"admin"`
+	Inherit *bool  `yaml:"inherit"`
+	Set     *bool  `yaml:"set"`
+}
+
+type membershipOption struct {
+	name       string
+	column     string
+	minVersion int
+}
+
+var membershipOptions = []membershipOption{
+	{name: "ADMIN", column: "admin_option"},
+	{name: "INHERIT", column: "inherit_option", minVersion: 160000},
+	{name: "SET", column: "set_option", minVersion: 160000},
+}
+
+// UnmarshalYAML allows a membership to be set as the name of the role, or as a membership object
+func (m *Membership) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var roleName string
+	if err := unmarshal(&roleName); err == nil {
+		m.Role = roleName
+		return nil
+	}
+	type plain Membership
+	if err := unmarshal((*plain)(m)); err != nil {
+		return err
+	}
+	if m.Role == "" {
+		return fmt.Errorf("role must be set for a membership")
+	}
+	return nil
+}
+
+// options returns the value for every membership option (nil when it is not managed)
+func (m Membership) options() map[string]*bool {
+	return map[string]*bool{
+		"ADMIN":   m.Admin,
+		"INHERIT": m.Inherit,
+		"SET":     m.Set,
+	}
+}
+
+// ValidateMembership returns an error if any of the membership options is not supported by the server version
+func (ph *Handler) ValidateMembership(m Membership) (err error) {
+	for _, option := range membershipOptions {
+		if option.minVersion == 0 || m.options()[option.name] == nil {
+			continue
+		}
+		version, err := ph.ServerVersion()
+		if err != nil {
+			return err
+		}
+		if version < option.minVersion {
+			return fmt.Errorf("membership option %s (for role %s) requires postgres %s or newer (server version is %s)",
+				strings.ToLower(option.name), m.Role, formatVersion(option.minVersion), formatVersion(version))
+		}
+	}
+	return nil
+}
+
+// GrantMembership grants a role with its membership options. When the role was already granted, the membership
+// options that differ are granted or revoked.
+func (r Role) GrantMembership(m Membership) (err error) {
+	ph := r.handler
+	err = ph.ValidateMembership(m)
+	if err != nil {
+		return err
+	}
+	version, err := ph.ServerVersion()
+	if err != nil {
+		return err
+	}
+	c := ph.conn
+	checkQry := `select granted.rolname granted_role 
+		from pg_auth_members auth inner join pg_roles 
+		granted on auth.roleid = granted.oid inner join pg_roles 
+		grantee on auth.member = grantee.oid where 
+		granted.rolname = $1 and grantee.rolname = $2`
+	if version >= 160000 {
+		// As of postgres 16 there is a row for every grantor, and only the grants by pgfga itself are managed
+		checkQry += " and auth.grantor = " + grantorSql
+	}
+	exists, err := c.runQueryExists(checkQry, m.Role, r.name)
+	if err != nil {
+		return err
+	}
+	options := m.options()
+	if !exists {
+		var withOptions []string
+		for _, option := range membershipOptions {
+			if value := options[option.name]; value != nil && (version >= 160000 || *value) {
+				withOptions = append(withOptions, membershipOptionSql(option.name, *value, version))
+			}
+		}
+		grantSql := fmt.Sprintf("GRANT %s TO %s", identifier(m.Role), identifier(r.name))
+		if len(withOptions) > 0 {
+			grantSql += " WITH " + strings.Join(withOptions, ", ")
+		}
+		err = c.runQueryExec(grantSql)
+		if err != nil {
+			return err
+		}
+		log.Infof("Role '%s' succesfully granted to user '%s'", m.Role, r.name)
+		return nil
+	}
+	log.Debugf("Role '%s' already granted to user '%s'", m.Role, r.name)
+	for _, option := range membershipOptions {
+		value := options[option.name]
+		if value == nil {
+			continue
+		}
+		hasOption, err := c.runQueryExists(checkQry+" and auth."+option.column, m.Role, r.name)
+		if err != nil {
+			return err
+		}
+		if hasOption == *value {
+			continue
+		}
+		if *value {
+			err = c.runQueryExec(fmt.Sprintf("GRANT %s TO %s WITH %s", identifier(m.Role), identifier(r.name),
+				membershipOptionSql(option.name, true, version)))
+		} else {
+			err = c.runQueryExec(fmt.Sprintf("REVOKE %s OPTION FOR %s FROM %s", option.name, identifier(m.Role),
+				identifier(r.name)))
+		}
+		if err != nil {
+			return err
+		}
+		log.Infof("Succesfully set %s option to %t for role '%s' granted to user '%s'", strings.ToLower(option.name),
+			*value, m.Role, r.name)
+	}
+	return nil
+}
+
+// grantorSql selects the grantor that postgres records for grants by the current user, which is the bootstrap
+// superuser when the current user is a superuser
+const grantorSql = `(select case when rolsuper then 10::oid else oid end from pg_roles where rolname = CURRENT_USER)`
+
+// membershipOptionSql returns the sql for a membership option in a GRANT statement (WITH ...)
+func membershipOptionSql(name string, value bool, version int) string {
+	if version < 160000 {
+		// before postgres 16, only WITH ADMIN OPTION exists
+		return name + " OPTION"
+	}
+	return fmt.Sprintf("%s %s", name, strings.ToUpper(fmt.Sprint(value)))
+}
@@ -8,7 +8,6 @@ import (
 	// #nosec
 	"crypto/md5"
 	"fmt"
-	"github.com/jackc/pgx/v4"
 	"strings"
 )
 
@@ -53,6 +52,10 @@ func NewRole(handler *Handler, name string, options RoleOptions, state State) (r
 	return r, nil
 }
 
+func (r Role) Name() string {
+	return r.name
+}
+
 func (r *Role) Drop() (err error) {
 	ph := r.handler
 	c := ph.conn
@@ -69,19 +72,36 @@ func (r *Role) Drop() (err error) {
 		delete(r.handler.roles, r.name)
 		return nil
 	}
-	var dbname string
-	var newOwner string
 	query := `select db.datname, o.rolname as newOwner from pg_database db inner join 
 			  pg_roles o on db.datdba = o.oid where db.datname != 'template0'`
-	row := c.conn.QueryRow(context.Background(), query)
-	for {
-		scanErr := row.Scan(&dbname, &newOwner)
-		if scanErr == pgx.ErrNoRows {
-			break
-		} else if scanErr != nil {
-			return fmt.Errorf("error getting ReadOnly grants (qry: %s, err %s)", query, err)
+	// all databases are read before reassigning, since reassigning can use the same connection
+	rows, err := c.conn.Query(context.Background(), query)
+	if err != nil {
+		return fmt.Errorf("error getting database owners (qry: %s, err %s)", query, err)
+	}
+	newOwners := make(map[string]string)
+	for rows.Next() {
+		var dbname string
+		var newOwner string
+		err = rows.Scan(&dbname, &newOwner)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error getting database owners (qry: %s, err %s)", query, err)
+		}
+		newOwners[dbname] = newOwner
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("error getting database owners (qry: %s, err %s)", query, err)
+	}
+	for dbname, newOwner := range newOwners {
+		db, exists := ph.databases[dbname]
+		if !exists {
+			// unmanaged databases are not added to the handler (GetDb would), so that they are not managed either
+			db = &Database{handler: ph, name: dbname}
 		}
-		dbConn := ph.GetDb(dbname).GetDbConnection()
+		dbConn := db.GetDbConnection()
 		err = dbConn.runQueryExec(fmt.Sprintf("REASSIGN OWNED BY %s TO %s", identifier(r.name), identifier(newOwner)))
 		if err != nil {
 			return err
@@ -94,6 +114,14 @@ func (r *Role) Drop() (err error) {
 	}
 	r.State = Absent
 	log.Infof("Role '%s' succesfully dropped", r.name)
+	err = ph.unmark(roleMarker, r.name)
+	if err != nil {
+		return err
+	}
+	err = ph.forgetPasswordChange(r.name)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -109,8 +137,22 @@ func (r Role) Create() (err error) {
 			return err
 		}
 		log.Infof("Role '%s' succesfully created", r.name)
+		err = r.handler.mark(roleMarker, r.name)
+		if err != nil {
+			return err
+		}
 	}
 	for _, option := range r.options {
+		if option == LoginOption && r.handler.noLoginExpired {
+			expired, err := r.isExpired()
+			if err != nil {
+				return err
+			}
+			if expired {
+				log.Debugf("Role '%s' has expired, not setting LOGIN", r.name)
+				continue
+			}
+		}
 		err = r.setRoleOption(option)
 		if err != nil {
 			return err
@@ -120,6 +162,10 @@ func (r Role) Create() (err error) {
 }
 
 func (r Role) setRoleOption(option RoleOption) (err error) {
+	err = r.handler.ValidateRoleOptions(RoleOptions{option.name: option})
+	if err != nil {
+		return err
+	}
 	c := r.handler.conn
 	optionSql := option.Sql()
 	exists, err := c.runQueryExists("SELECT rolname FROM pg_roles WHERE rolname = $1 AND "+optionSql, r.name)
@@ -137,26 +183,7 @@ func (r Role) setRoleOption(option RoleOption) (err error) {
 }
 
 func (r Role) GrantRole(grantedRole *Role) (err error) {
-	c := r.handler.conn
-	checkQry := `select granted.rolname granted_role 
-		from pg_auth_members auth inner join pg_roles 
-		granted on auth.roleid = granted.oid inner join pg_roles 
-		grantee on auth.member = grantee.oid where 
-		granted.rolname = $1 and grantee.rolname = $2`
-	exists, err := c.runQueryExists(checkQry, grantedRole.name, r.name)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		err = c.runQueryExec(fmt.Sprintf("GRANT %s TO %s", identifier(grantedRole.name), identifier(r.name)))
-		if err != nil {
-			return err
-		}
-		log.Infof("Role '%s' succesfully granted to user '%s'", grantedRole.name, r.name)
-	} else {
-		log.Debugf("Role '%s' already granted to user '%s'", grantedRole.name, r.name)
-	}
-	return nil
+	return r.GrantMembership(Membership{Role: grantedRole.name})
 }
 
 func (r Role) RevokeRole(roleName string) (err error) {
@@ -180,17 +207,33 @@ func (r Role) RevokeRole(roleName string) (err error) {
 	return nil
 }
 
+// IsHashedPassword returns true if password is a md5 hash (as stored in pg_authid), and not a cleartext password
+func IsHashedPassword(password string) bool {
+	return len(password) == 35 && strings.HasPrefix(password, "md5")
+}
+
+func (r Role) hashPassword(password string) (hashedPassword string) {
+	if IsHashedPassword(password) {
+		return password
+	}
+	// #nosec
+	return fmt.Sprintf("md5%x", md5.Sum([]byte(password+r.name)))
+}
+
+// HasPassword returns true if password (cleartext or md5 hashed) is the current password of the role
+func (r Role) HasPassword(password string) (hasPassword bool, err error) {
+	if password == "" {
+		return false, nil
+	}
+	checkQry := `SELECT usename FROM pg_shadow WHERE usename = $1 AND passwd = $2`
+	return r.handler.conn.runQueryExists(checkQry, r.name, r.hashPassword(password))
+}
+
 func (r Role) SetPassword(password string) (err error) {
 	if password == "" {
 		return r.ResetPassword()
 	}
-	var hashedPassword string
-	if len(password) == 35 && strings.HasPrefix(password, "md5") {
-		hashedPassword = password
-	} else {
-		// #nosec
-		hashedPassword = fmt.Sprintf("md5%x", md5.Sum([]byte(password+r.name)))
-	}
+	hashedPassword := r.hashPassword(password)
 	c := r.handler.conn
 	checkQry := `SELECT rolname FROM pg_roles where rolname = $1
 			     and rolname not in (select usename from pg_shadow WHERE usename = $1
@@ -268,3 +311,24 @@ func (r Role) ResetExpiry() (err error) {
 	return nil
 
 }
+
+func (r Role) SetConnectionLimit(limit int) (err error) {
+	c := r.handler.conn
+	checkQry := `SELECT rolname FROM pg_roles where rolname = $1 AND rolconnlimit != $2;`
+	exists, err := c.runQueryExists(checkQry, r.name, limit)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = c.runQueryExec(fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", identifier(r.name), limit))
+		if err != nil {
+			return err
+		}
+		log.Infof("Succesfully set connection limit for user '%s' to %d", r.name, limit)
+	}
+	return nil
+}
+
+func (r Role) SetComment(comment string) (err error) {
+	return setComment(r.handler.conn, roleObject, r.name, comment)
+}
@@ -2,6 +2,8 @@ package pg
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -9,25 +11,49 @@ type RoleOption struct {
 	name    string
 	sql     string
 	enabled bool
+	// value is set for options with a value (CONNECTION LIMIT)
+	value string
 }
 
 func NewRoleOption(name string) (opt RoleOption, err error) {
-	opt.name = strings.ToUpper(name)
+	// normalize whitespace, so that (e.a.) 'connection  limit 5' is also accepted
+	opt.name = strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+	for valueOption, column := range ValueRoleOptions {
+		if !strings.HasPrefix(opt.name, valueOption+" ") {
+			continue
+		}
+		value := strings.TrimPrefix(opt.name, valueOption+" ")
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < -1 {
+			return opt, fmt.Errorf("invalid RoleOption %s (%s should be followed by a number, or -1)", name,
+				valueOption)
+		}
+		opt.name = valueOption
+		opt.value = strconv.Itoa(limit)
+		opt.sql = fmt.Sprintf("%s = %d", column, limit)
+		opt.enabled = true
+		return opt, nil
+	}
 	if strings.HasPrefix(opt.name, "NO") {
 		opt.name = opt.name[2:]
 		opt.enabled = false
 	} else {
 		opt.enabled = true
 	}
-	if sql, exists := ValidRoleOptions[name]; exists {
+	if alias, exists := roleOptionAliases[opt.name]; exists {
+		opt.name = alias
+	}
+	if sql, exists := ValidRoleOptions[opt.name]; exists {
 		opt.sql = sql
 		return opt, nil
 	}
 	var validRoleOptionNames []string
-	for _, oName := range ValidRoleOptions {
+	for oName := range ValidRoleOptions {
 		validRoleOptionNames = append(validRoleOptionNames, oName)
 	}
-	return opt, fmt.Errorf("invalid RoleOption %s (should fit to re `NO(%s)`)", name, strings.Join(validRoleOptionNames, "|"))
+	sort.Strings(validRoleOptionNames)
+	return opt, fmt.Errorf("invalid RoleOption %s (should fit to re `(NO)(%s)` or `CONNECTION LIMIT n`)", name,
+		strings.Join(validRoleOptionNames, "|"))
 }
 
 func (opt RoleOption) Valid() (isValid bool) {
@@ -36,6 +62,9 @@ func (opt RoleOption) Valid() (isValid bool) {
 
 func (opt RoleOption) String() (name string) {
 	name = strings.ToUpper(opt.name)
+	if _, exists := ValueRoleOptions[name]; exists {
+		return fmt.Sprintf("%s %s", name, opt.value)
+	}
 	if _, exists := ValidRoleOptions[name]; !exists {
 		return ""
 	}
@@ -45,31 +74,85 @@ func (opt RoleOption) String() (name string) {
 	return fmt.Sprintf("NO%s", name)
 }
 
+// hasValue returns true for options with a value (CONNECTION LIMIT), which cannot be negated
+func (opt RoleOption) hasValue() bool {
+	_, exists := ValueRoleOptions[opt.name]
+	return exists
+}
+
 func (opt RoleOption) Sql() (sql string) {
-	if opt.enabled {
+	if opt.enabled || opt.hasValue() {
 		return opt.sql
 	}
 	return fmt.Sprintf("not %s", opt.sql)
 }
+
+// Inverse returns the negated option (e.a. NOLOGIN for LOGIN). Options with a value are returned as is.
 func (opt RoleOption) Inverse() (invOpt RoleOption) {
+	if opt.hasValue() {
+		return opt
+	}
 	return RoleOption{
 		name:    opt.name,
 		sql:     opt.sql,
 		enabled: !opt.enabled,
+		value:   opt.value,
 	}
 }
 
 var (
+	// ValidRoleOptions holds all boolean role attributes, with the column in pg_roles that holds them
 	ValidRoleOptions = map[string]string{
 		"SUPERUSER":   "rolsuper",
-		"CREATEROLE ": "rolcreaterole",
-		"CREATEUSER":  "rolcreaterole",
-		"INHERIT":    "rolinherit",
+		"CREATEDB":    "rolcreatedb",
+		"CREATEROLE":  "rolcreaterole",
+		"INHERIT":     "rolinherit",
 		"LOGIN":       "rolcanlogin",
 		"REPLICATION": "rolreplication",
+		"BYPASSRLS":   "rolbypassrls",
+	}
+	// ValueRoleOptions holds all role attributes with a value, with the column in pg_roles that holds them
+	ValueRoleOptions = map[string]string{
+		"CONNECTION LIMIT": "rolconnlimit",
+	}
+	// roleOptionAliases holds the (deprecated) names of role options that are an alias for another option
+	roleOptionAliases = map[string]string{
+		"CREATEUSER": "CREATEROLE",
+	}
+	// roleOptionMinVersions holds the minimal server version (server_version_num) for role options
+	roleOptionMinVersions = map[string]int{
+		"REPLICATION": 90100,
+		"BYPASSRLS":   90500,
 	}
 )
 
+// formatVersion formats a server_version_num (e.a. 90500 or 160002) as a major version (e.a. 9.5 or 16)
+func formatVersion(version int) string {
+	if version >= 100000 {
+		return strconv.Itoa(version / 10000)
+	}
+	return fmt.Sprintf("%d.%d", version/10000, version/100%100)
+}
+
+// ValidateRoleOptions returns an error if any of the role options is not supported by the server version
+func (ph *Handler) ValidateRoleOptions(options RoleOptions) (err error) {
+	for _, option := range options {
+		minVersion, exists := roleOptionMinVersions[option.name]
+		if !exists {
+			continue
+		}
+		version, err := ph.ServerVersion()
+		if err != nil {
+			return err
+		}
+		if version < minVersion {
+			return fmt.Errorf("role option %s requires postgres %s or newer (server version is %s)", option,
+				formatVersion(minVersion), formatVersion(version))
+		}
+	}
+	return nil
+}
+
 // MarshalYAML marshals the enum as a quoted json string
 func (opt RoleOption) MarshalYAML() (interface{}, error) {
 	return opt.String(), nil
@@ -85,9 +168,7 @@ func (opt *RoleOption) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err != nil {
 		return err
 	}
-	opt.name = tmpOpt.name
-	opt.sql = tmpOpt.sql
-	opt.enabled = tmpOpt.enabled
+	*opt = tmpOpt
 	return nil
 }
 
@@ -97,6 +178,19 @@ func (ro RoleOptions) AddOption(opt RoleOption) {
 	ro[opt.name] = opt
 }
 
+// NewRoleOptions parses a list of option names, where later options negate earlier options
+func NewRoleOptions(names []string) (ro RoleOptions, err error) {
+	ro = make(RoleOptions)
+	for _, name := range names {
+		option, err := NewRoleOption(name)
+		if err != nil {
+			return nil, err
+		}
+		ro.AddOption(option)
+	}
+	return ro, nil
+}
+
 //func (ros RoleOptions)Join(sep string) (joined string) {
 //	var strOptions []string
 //	for _, option := range ros {
@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRoleOption(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+		sql      string
+	}{
+		{"LOGIN", "LOGIN", "rolcanlogin"},
+		{"nologin", "NOLOGIN", "not rolcanlogin"},
+		{"SuperUser", "SUPERUSER", "rolsuper"},
+		{"CREATEUSER", "CREATEROLE", "rolcreaterole"},
+		{"nocreateuser", "NOCREATEROLE", "not rolcreaterole"},
+		{"NOBYPASSRLS", "NOBYPASSRLS", "not rolbypassrls"},
+		{"CONNECTION LIMIT 5", "CONNECTION LIMIT 5", "rolconnlimit = 5"},
+		{" connection   limit 10 ", "CONNECTION LIMIT 10", "rolconnlimit = 10"},
+		{"CONNECTION LIMIT -1", "CONNECTION LIMIT -1", "rolconnlimit = -1"},
+	} {
+		option, err := NewRoleOption(test.name)
+		if err != nil {
+			t.Errorf("%q: %v", test.name, err)
+			continue
+		}
+		if option.String() != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.name, test.expected, option.String())
+		}
+		if option.Sql() != test.sql {
+			t.Errorf("%q: expected sql %q, got %q", test.name, test.sql, option.Sql())
+		}
+	}
+}
+
+func TestNewRoleOptionInvalid(t *testing.T) {
+	for _, name := range []string{"", "NOTHING", "CONNECTION LIMIT", "CONNECTION LIMIT x", "CONNECTION LIMIT -2",
+		"NOCONNECTION LIMIT 5", "CONNECTIONLIMIT 5"} {
+		_, err := NewRoleOption(name)
+		if err == nil || !strings.Contains(err.Error(), "invalid RoleOption") {
+			t.Errorf("%q: expected an invalid RoleOption error, got %v", name, err)
+		}
+	}
+}
+
+func TestRoleOptionInverse(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		expected string
+		sql      string
+	}{
+		{"LOGIN", "NOLOGIN", "not rolcanlogin"},
+		{"NOINHERIT", "INHERIT", "rolinherit"},
+		{"CONNECTION LIMIT 5", "CONNECTION LIMIT 5", "rolconnlimit = 5"},
+	} {
+		option, err := NewRoleOption(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inverse := option.Inverse()
+		if inverse.String() != test.expected || inverse.Sql() != test.sql {
+			t.Errorf("%q: expected inverse %s (%s), got %s (%s)", test.name, test.expected, test.sql,
+				inverse.String(), inverse.Sql())
+		}
+	}
+}
+
+func TestNewRoleOptions(t *testing.T) {
+	options, err := NewRoleOptions([]string{"SUPERUSER", "NOSUPERUSER", "CONNECTION LIMIT 5",
+		"connection limit 10", "CREATEUSER", "NOCREATEROLE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"SUPERUSER":        "NOSUPERUSER",
+		"CONNECTION LIMIT": "CONNECTION LIMIT 10",
+		"CREATEROLE":       "NOCREATEROLE",
+	}
+	if len(options) != len(expected) {
+		t.Errorf("expected %d options, got %d", len(expected), len(options))
+	}
+	for name, option := range expected {
+		if options[name].String() != option {
+			t.Errorf("expected %s to be %s, got %s", name, option, options[name].String())
+		}
+	}
+	_, err = NewRoleOptions([]string{"LOGIN", "INVALID"})
+	if err == nil {
+		t.Error("expected an error for an invalid option")
+	}
+}
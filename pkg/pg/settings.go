@@ -0,0 +1,147 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RoleSettings holds configuration parameters for a role (ALTER ROLE ... SET), by database ("" for all databases)
+type RoleSettings map[string]map[string]string
+
+// listSettings are configuration parameters that hold a list of identifiers
+var listSettings = map[string]bool{
+	"search_path":               true,
+	"temp_tablespaces":          true,
+	"local_preload_libraries":   true,
+	"session_preload_libraries": true,
+}
+
+// settingElements splits the value of a list setting into its elements (without quotes)
+func settingElements(value string) (elements []string) {
+	for _, element := range strings.Split(value, ",") {
+		element = strings.TrimSpace(element)
+		if len(element) > 1 && strings.HasPrefix(element, "\"") && strings.HasSuffix(element, "\"") {
+			element = strings.Replace(element[1:len(element)-1], "\"\"", "\"", -1)
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// normalizeSetting returns a value that can be compared to the value stored in pg_db_role_setting
+func normalizeSetting(key string, value string) string {
+	if !listSettings[key] {
+		return value
+	}
+	return strings.Join(settingElements(value), ", ")
+}
+
+// settingSql returns the value of a setting ready to be used in an ALTER ROLE ... SET statement
+func settingSql(key string, value string) string {
+	if !listSettings[key] {
+		return quotedSqlValue(value)
+	}
+	var elements []string
+	for _, element := range settingElements(value) {
+		elements = append(elements, identifier(element))
+	}
+	return strings.Join(elements, ", ")
+}
+
+// getSettings returns the current settings of the role from pg_db_role_setting
+func (r Role) getSettings() (settings RoleSettings, err error) {
+	c := r.handler.conn
+	err = c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	qry := `SELECT COALESCE(d.datname, ''), unnest(s.setconfig) FROM pg_db_role_setting s
+		INNER JOIN pg_roles r ON s.setrole = r.oid LEFT JOIN pg_database d ON s.setdatabase = d.oid
+		WHERE r.rolname = $1`
+	rows, err := c.conn.Query(context.Background(), qry, r.name)
+	if err != nil {
+		return nil, fmt.Errorf("getSettings (%s) failed: %v", qry, err)
+	}
+	defer rows.Close()
+	settings = make(RoleSettings)
+	for rows.Next() {
+		var dbName, setting string
+		err = rows.Scan(&dbName, &setting)
+		if err != nil {
+			return nil, fmt.Errorf("getSettings (%s) failed: %v", qry, err)
+		}
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, exists := settings[dbName]; !exists {
+			settings[dbName] = make(map[string]string)
+		}
+		settings[dbName][parts[0]] = parts[1]
+	}
+	return settings, rows.Err()
+}
+
+func (r Role) alterSql(dbName string) string {
+	if dbName == "" {
+		return fmt.Sprintf("ALTER ROLE %s", identifier(r.name))
+	}
+	return fmt.Sprintf("ALTER ROLE %s IN DATABASE %s", identifier(r.name), identifier(dbName))
+}
+
+// SetSettings sets the configuration parameters of the role (ALTER ROLE ... SET) where they differ.
+// With strict users, settings that are not configured are reset.
+func (r Role) SetSettings(configured RoleSettings) (err error) {
+	// configuration parameter names are case-insensitive
+	settings := make(RoleSettings)
+	for dbName, dbSettings := range configured {
+		settings[dbName] = make(map[string]string)
+		for key, value := range dbSettings {
+			settings[dbName][strings.ToLower(key)] = value
+		}
+	}
+	current, err := r.getSettings()
+	if err != nil {
+		return err
+	}
+	c := r.handler.conn
+	for dbName, dbSettings := range settings {
+		keys := make([]string, 0, len(dbSettings))
+		for key := range dbSettings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := dbSettings[key]
+			currentValue, exists := current[dbName][key]
+			if exists && normalizeSetting(key, currentValue) == normalizeSetting(key, value) {
+				continue
+			}
+			err = c.runQueryExec(fmt.Sprintf("%s SET %s = %s", r.alterSql(dbName), identifier(key),
+				settingSql(key, value)))
+			if err != nil {
+				return err
+			}
+			log.Infof("Succesfully set %s for role '%s' (database '%s')", key, r.name, dbName)
+		}
+	}
+	for dbName, dbSettings := range current {
+		for key := range dbSettings {
+			if _, declared := settings[dbName][key]; declared {
+				continue
+			}
+			if !r.handler.strictOptions.Users {
+				log.Debugf("not resetting %s for role '%s' (config.strict.users is not True)", key, r.name)
+				continue
+			}
+			err = c.runQueryExec(fmt.Sprintf("%s RESET %s", r.alterSql(dbName), identifier(key)))
+			if err != nil {
+				return err
+			}
+			log.Infof("Succesfully reset %s for role '%s' (database '%s')", key, r.name, dbName)
+		}
+	}
+	return nil
+}